@@ -7,6 +7,7 @@ import (
 
 	"github.com/cobalto/noppera/docs"
 	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/events"
 	"github.com/cobalto/noppera/internal/handlers"
 	"github.com/cobalto/noppera/internal/jobs"
 	"github.com/cobalto/noppera/internal/middleware"
@@ -59,9 +60,15 @@ func main() {
 	archiver.Start()
 	defer archiver.Stop()
 
+	broker := events.NewBroker(db)
+	broker.Start()
+	defer broker.Stop()
+
 	r := chi.NewRouter()
+	r.Use(middleware.RealIP(cfg))
 	r.Use(middleware.Logging(cfg))
 	r.Use(middleware.CORS(cfg))
+	r.Use(middleware.Compress(cfg))
 
 	// Health check endpoints (no rate limiting)
 	handlers.RegisterHealth(r, db)
@@ -71,13 +78,18 @@ func main() {
 		httpSwagger.URL("http://localhost:8080/swagger/doc.json"),
 	))
 
+	// WebSocket replies share the HTTP reply route's limits
+	limiter := middleware.NewLimiter(cfg)
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.RateLimitPublic(cfg))
+		r.Use(middleware.RateLimitPublic(limiter))
 		handlers.RegisterBoards(r, db, store)
 		handlers.RegisterPosts(r, db, store)
-		handlers.RegisterSearch(r, db)
+		handlers.RegisterSearch(r, db, cfg)
 		handlers.RegisterFlags(r, db, cfg)
-		handlers.RegisterThreads(r, db)
+		handlers.RegisterThreads(r, db, cfg)
+		handlers.RegisterPolls(r, db, cfg)
+		handlers.RegisterEvents(r, db, broker, cfg)
+		handlers.RegisterWebSocket(r, db, store, broker, limiter)
 	})
 	handlers.RegisterAuth(r, db, cfg)
 
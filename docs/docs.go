@@ -107,7 +107,15 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "type": "object",
+                            "properties": {
+                                "password": {
+                                    "type": "string"
+                                },
+                                "username": {
+                                    "type": "string"
+                                }
+                            }
                         }
                     }
                 ],
@@ -115,8 +123,7 @@ const docTemplate = `{
                     "201": {
                         "description": "User created successfully",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/handlers.UserView"
                         }
                     },
                     "400": {
@@ -159,7 +166,15 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "type": "object",
+                            "properties": {
+                                "password": {
+                                    "type": "string"
+                                },
+                                "username": {
+                                    "type": "string"
+                                }
+                            }
                         }
                     }
                 ],
@@ -167,8 +182,7 @@ const docTemplate = `{
                     "201": {
                         "description": "Admin user created successfully",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/handlers.UserView"
                         }
                     },
                     "400": {
@@ -200,7 +214,7 @@ const docTemplate = `{
         },
         "/boards": {
             "get": {
-                "description": "Get all available boards",
+                "description": "Get available boards, paginated by cursor",
                 "produces": [
                     "application/json"
                 ],
@@ -208,14 +222,49 @@ const docTemplate = `{
                     "boards"
                 ],
                 "summary": "List boards",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cursor from a previous page's next_cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a cached response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified of a cached response",
+                        "name": "If-Modified-Since",
+                        "in": "header"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "List of boards",
+                        "description": "Page of boards",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Board"
-                            }
+                            "$ref": "#/definitions/handlers.PageResponse-models_Board"
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid cursor or limit",
+                        "schema": {
+                            "type": "string"
                         }
                     },
                     "500": {
@@ -288,9 +337,113 @@ const docTemplate = `{
                 }
             }
         },
+        "/boards/{boardSlug}/events": {
+            "get": {
+                "description": "Stream new threads, replies, deletions and thread state changes on a board as Server-Sent Events. Resume with the Last-Event-ID header or last_event_id query parameter.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "events"
+                ],
+                "summary": "Stream board events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Board slug",
+                        "name": "boardSlug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Last event ID received",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Last event ID received",
+                        "name": "last_event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event stream",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Board not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/boards/{boardSlug}/threads": {
+            "get": {
+                "description": "Get the active threads of a board, most recently bumped first, paginated by cursor",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "threads"
+                ],
+                "summary": "List threads",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Board slug",
+                        "name": "boardSlug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor from a previous page's next_cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Page of threads (ModPostView items for moderators)",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PageResponse-handlers_PostView"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid cursor or limit",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Board not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list threads",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
             "post": {
-                "description": "Create a new thread in a board",
+                "description": "Create a new thread in a board. A valid bearer token is optional and attributes the thread to the user.",
                 "consumes": [
                     "application/json"
                 ],
@@ -310,22 +463,60 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Thread data",
+                        "description": "Thread data (name may include #password or ##password for a tripcode; password is an optional delete password; spoiler hides the image behind a placeholder and defaults to the board's spoiler_by_default; command runs a server-side command such as ",
                         "name": "thread",
                         "in": "body",
                         "required": true,
                         "schema": {
                             "type": "object",
                             "properties": {
+                                "capcode": {
+                                    "type": "string"
+                                },
+                                "command": {
+                                    "type": "string"
+                                },
                                 "content": {
                                     "type": "string"
                                 },
+                                "expires_in": {
+                                    "type": "integer"
+                                },
                                 "image": {
                                     "type": "string"
                                 },
                                 "metadata": {
                                     "type": "object"
                                 },
+                                "name": {
+                                    "type": "string"
+                                },
+                                "password": {
+                                    "type": "string"
+                                },
+                                "poll": {
+                                    "type": "object",
+                                    "properties": {
+                                        "closes_at": {
+                                            "type": "string"
+                                        },
+                                        "multiple": {
+                                            "type": "boolean"
+                                        },
+                                        "options": {
+                                            "type": "array",
+                                            "items": {
+                                                "type": "string"
+                                            }
+                                        },
+                                        "question": {
+                                            "type": "string"
+                                        }
+                                    }
+                                },
+                                "spoiler": {
+                                    "type": "boolean"
+                                },
                                 "tags": {
                                     "type": "array",
                                     "items": {
@@ -341,9 +532,9 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "201": {
-                        "description": "Thread created successfully",
+                        "description": "Thread created successfully, with a delete_token if no password was given",
                         "schema": {
-                            "$ref": "#/definitions/models.Post"
+                            "$ref": "#/definitions/handlers.PostView"
                         }
                     },
                     "400": {
@@ -353,7 +544,7 @@ const docTemplate = `{
                         }
                     },
                     "403": {
-                        "description": "Thread limit reached",
+                        "description": "Thread limit reached (boards with the reject policy, or full of sticky threads)",
                         "schema": {
                             "type": "string"
                         }
@@ -373,6 +564,78 @@ const docTemplate = `{
                 }
             }
         },
+        "/boards/{boardSlug}/threads/{threadNumber}": {
+            "get": {
+                "description": "Get a thread and its replies by the board post number of its opening post",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "threads"
+                ],
+                "summary": "Get thread by number",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Board slug",
+                        "name": "boardSlug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Board post number of the thread",
+                        "name": "threadNumber",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a cached response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified of a cached response",
+                        "name": "If-Modified-Since",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Thread with replies",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ThreadResponse"
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid thread number",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Board not found, or thread not found or archived",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to fetch replies",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/health": {
             "get": {
                 "description": "Check the health status of the API and its dependencies",
@@ -482,20 +745,47 @@ const docTemplate = `{
                         "description": "Board ID to filter by",
                         "name": "board_id",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor from a previous page's next_cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a cached response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified of a cached response",
+                        "name": "If-Modified-Since",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Search results",
+                        "description": "Page of search results (ModPostView items for moderators)",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Post"
-                            }
+                            "$ref": "#/definitions/handlers.PageResponse-handlers_PostView"
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified",
+                        "schema": {
+                            "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Invalid board ID",
+                        "description": "Invalid board ID, cursor or limit",
                         "schema": {
                             "type": "string"
                         }
@@ -508,68 +798,984 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "handlers.HealthResponse": {
-            "type": "object",
-            "properties": {
-                "services": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "string"
-                    }
-                },
-                "status": {
-                    "type": "string"
-                },
-                "timestamp": {
-                    "type": "string"
-                },
-                "uptime": {
-                    "type": "string"
-                }
-            }
         },
-        "models.Board": {
-            "type": "object",
-            "properties": {
-                "created_at": {
-                    "type": "string"
-                },
-                "description": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "integer"
-                },
-                "name": {
-                    "type": "string"
-                },
-                "settings": {
-                    "type": "object",
+        "/posts/{postID}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replace a post's content (and a thread's title), keeping the previous version as a revision. Owners may edit within the board's edit_window (seconds); moderators may edit at any time. Posts in archived, deleted, expired or locked threads cannot be edited.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Edit post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "postID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New title and content",
+                        "name": "post",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "content": {
+                                    "type": "string"
+                                },
+                                "title": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Edited post (ModPostView for moderators)",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.PostView"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid post ID or request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Post not owned by user, thread locked, or past the edit window",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Post or thread not found, archived or expired",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to edit post",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Soft-delete a post using the delete password given when it was created, or the delete_token returned if none was. Only allowed within the board's delete_window (seconds) after posting.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Delete post with password",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "postID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Delete password or token",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "password": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Post deleted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid post ID or request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Incorrect password or past the delete window",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Post not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete post",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/posts/{postID}/admin": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Soft-delete any post, which is shown as a tombstone in thread views until purged. Deleting a thread's opening post hides the thread.",
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Delete post (moderator)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "postID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reason for deletion",
+                        "name": "reason",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Post deleted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid post ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Moderator access required",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Post not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete post",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/posts/{postID}/file": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Remove a post's image from storage, leaving the post and its text in place",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Delete post file (moderator)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "postID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Post without its image",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ModPostView"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid post ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Moderator access required",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Post not found or has no image",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete image",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/posts/{postID}/purge": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Permanently delete a post, or a thread with all of its replies, along with their flags, quotes, revisions and images. Unlike regular deletion, this leaves no tombstone.",
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Purge post (admin)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "postID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Post purged",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid post ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin access required",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Post not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to purge post",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/posts/{postID}/revisions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get the previous versions of an edited post, oldest first (moderators only)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "List post revisions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "postID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Revisions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Revision"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid post ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Moderator access required",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Post not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list revisions",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/threads/{threadID}/events": {
+            "get": {
+                "description": "Stream new replies, deletions and state changes of a thread as Server-Sent Events. Resume with the Last-Event-ID header or last_event_id query parameter.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "events"
+                ],
+                "summary": "Stream thread events",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Thread ID",
+                        "name": "threadID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Last event ID received",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Last event ID received",
+                        "name": "last_event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event stream",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid thread ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Thread not found or archived",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/threads/{threadID}/poll/votes": {
+            "post": {
+                "description": "Vote in a thread's poll by option index: exactly one option for single-choice polls, one or more for multiple-choice polls. Each account and each IP may vote once, so a logged-in vote also uses up the IP's vote and vice versa. Closed polls, and polls in archived threads, no longer accept votes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "polls"
+                ],
+                "summary": "Vote in poll",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Thread ID",
+                        "name": "threadID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Indexes of the chosen options",
+                        "name": "ballot",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "options": {
+                                    "type": "array",
+                                    "items": {
+                                        "type": "integer"
+                                    }
+                                }
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Poll with updated tallies",
+                        "schema": {
+                            "$ref": "#/definitions/models.Poll"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid thread ID or choices",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Poll is closed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Poll not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Already voted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to vote",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/threads/{threadID}/state": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Pin a thread (sticky threads are listed first, lowest sticky value first; null unpins it), lock it against replies, or make it cyclical so the oldest replies are pruned past the reply limit. Moderators only.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "threads"
+                ],
+                "summary": "Set thread state",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Thread ID",
+                        "name": "threadID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Thread state",
+                        "name": "state",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "cyclical": {
+                                    "type": "boolean"
+                                },
+                                "locked": {
+                                    "type": "boolean"
+                                },
+                                "sticky": {
+                                    "type": "integer"
+                                }
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated thread",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ModPostView"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid thread ID or request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Moderator access required",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Thread not found or archived",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to update thread",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{userID}/role": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Make a user a janitor, mod or admin (or a plain user again). Staff roles may post with a matching capcode; mods and admins get moderator access, and only admins get admin access. Takes effect at the user's next login. Admin only.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Set user role",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New role: user, janitor, mod or admin",
+                        "name": "role",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "role": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated user",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UserView"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid user ID or role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin access required",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to set role",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ws": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Upgrade to a WebSocket. Clients send JSON messages of type \"subscribe\" or \"unsubscribe\" (with boards and threads) and \"reply\" (with thread_id, content, image, tags, metadata), and receive \"event\", \"subscribed\", \"unsubscribed\", \"posted\" and \"error\" messages. The token may be passed in the access_token query parameter.",
+                "tags": [
+                    "events"
+                ],
+                "summary": "WebSocket API",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JWT, for clients that cannot set headers",
+                        "name": "access_token",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching protocols",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "handlers.HealthResponse": {
+            "type": "object",
+            "properties": {
+                "services": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "string"
+                },
+                "uptime": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ModPostView": {
+            "type": "object",
+            "properties": {
+                "archived_at": {
+                    "type": "string"
+                },
+                "backlinks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.QuoteRef"
+                    }
+                },
+                "board_id": {
+                    "type": "integer"
+                },
+                "capcode": {
+                    "type": "string"
+                },
+                "content": {
+                    "type": "string"
+                },
+                "content_html": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "cyclical": {
+                    "type": "boolean"
+                },
+                "delete_reason": {
+                    "type": "string"
+                },
+                "delete_token": {
+                    "type": "string"
+                },
+                "deleted": {
+                    "type": "boolean"
+                },
+                "deleted_at": {
+                    "type": "string"
+                },
+                "deleted_by": {
+                    "type": "integer"
+                },
+                "edited": {
+                    "type": "boolean"
+                },
+                "edited_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "file_deleted_at": {
+                    "type": "string"
+                },
+                "flag_count": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "image_url": {
+                    "type": "string"
+                },
+                "ip_hash": {
+                    "type": "string"
+                },
+                "last_bumped_at": {
+                    "type": "string"
+                },
+                "locked": {
+                    "type": "boolean"
+                },
+                "metadata": {
+                    "type": "object",
                     "additionalProperties": true
                 },
-                "slug": {
+                "name": {
+                    "type": "string"
+                },
+                "number": {
+                    "type": "integer"
+                },
+                "poll": {
+                    "$ref": "#/definitions/models.Poll"
+                },
+                "poster_id": {
+                    "type": "string"
+                },
+                "quotes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.QuoteRef"
+                    }
+                },
+                "sage": {
+                    "type": "boolean"
+                },
+                "spoiler": {
+                    "type": "boolean"
+                },
+                "status": {
+                    "$ref": "#/definitions/models.ThreadStatus"
+                },
+                "sticky": {
+                    "type": "integer"
+                },
+                "thread_id": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "tripcode": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.PageResponse-handlers_PostView": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.PostView"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.PageResponse-models_Board": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Board"
+                    }
+                },
+                "next_cursor": {
                     "type": "string"
                 }
             }
         },
-        "models.Post": {
+        "handlers.PostView": {
             "type": "object",
             "properties": {
                 "archived_at": {
                     "type": "string"
                 },
+                "backlinks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.QuoteRef"
+                    }
+                },
                 "board_id": {
                     "type": "integer"
                 },
+                "capcode": {
+                    "type": "string"
+                },
                 "content": {
                     "type": "string"
                 },
+                "content_html": {
+                    "type": "string"
+                },
                 "created_at": {
                     "type": "string"
                 },
+                "cyclical": {
+                    "type": "boolean"
+                },
+                "delete_token": {
+                    "type": "string"
+                },
+                "deleted": {
+                    "type": "boolean"
+                },
+                "deleted_at": {
+                    "type": "string"
+                },
+                "edited": {
+                    "type": "boolean"
+                },
+                "edited_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "file_deleted_at": {
+                    "type": "string"
+                },
                 "id": {
                     "type": "integer"
                 },
@@ -579,25 +1785,72 @@ const docTemplate = `{
                 "last_bumped_at": {
                     "type": "string"
                 },
+                "locked": {
+                    "type": "boolean"
+                },
                 "metadata": {
                     "type": "object",
                     "additionalProperties": true
                 },
+                "name": {
+                    "type": "string"
+                },
+                "number": {
+                    "type": "integer"
+                },
+                "poll": {
+                    "$ref": "#/definitions/models.Poll"
+                },
+                "poster_id": {
+                    "type": "string"
+                },
+                "quotes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.QuoteRef"
+                    }
+                },
+                "sage": {
+                    "type": "boolean"
+                },
+                "spoiler": {
+                    "type": "boolean"
+                },
+                "status": {
+                    "$ref": "#/definitions/models.ThreadStatus"
+                },
+                "sticky": {
+                    "type": "integer"
+                },
                 "thread_id": {
                     "type": "integer"
                 },
                 "title": {
                     "type": "string"
                 },
+                "tripcode": {
+                    "type": "string"
+                },
                 "updated_at": {
                     "type": "string"
+                }
+            }
+        },
+        "handlers.ThreadResponse": {
+            "type": "object",
+            "properties": {
+                "replies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.PostView"
+                    }
                 },
-                "user_id": {
-                    "type": "integer"
+                "thread": {
+                    "$ref": "#/definitions/handlers.PostView"
                 }
             }
         },
-        "models.User": {
+        "handlers.UserView": {
             "type": "object",
             "properties": {
                 "created_at": {
@@ -609,13 +1862,167 @@ const docTemplate = `{
                 "is_admin": {
                     "type": "boolean"
                 },
-                "password": {
+                "role": {
                     "type": "string"
                 },
                 "username": {
                     "type": "string"
                 }
             }
+        },
+        "models.Board": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "settings": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "slug": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Poll": {
+            "type": "object",
+            "properties": {
+                "closed": {
+                    "type": "boolean"
+                },
+                "closes_at": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "multiple": {
+                    "type": "boolean"
+                },
+                "options": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PollOption"
+                    }
+                },
+                "question": {
+                    "type": "string"
+                },
+                "thread_id": {
+                    "type": "integer"
+                },
+                "voters": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PollOption": {
+            "type": "object",
+            "properties": {
+                "text": {
+                    "type": "string"
+                },
+                "votes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.QuoteRef": {
+            "type": "object",
+            "properties": {
+                "board": {
+                    "type": "string"
+                },
+                "cross_thread": {
+                    "type": "boolean"
+                },
+                "number": {
+                    "type": "integer"
+                },
+                "post_id": {
+                    "type": "integer"
+                },
+                "thread_id": {
+                    "type": "integer"
+                },
+                "thread_number": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Revision": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                },
+                "content_html": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "edited_by": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "post_id": {
+                    "type": "integer"
+                },
+                "revision": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ThreadStatus": {
+            "type": "object",
+            "properties": {
+                "bump_limit": {
+                    "type": "integer"
+                },
+                "bump_limit_reached": {
+                    "type": "boolean"
+                },
+                "image_limit": {
+                    "type": "integer"
+                },
+                "image_limit_reached": {
+                    "type": "boolean"
+                },
+                "images": {
+                    "type": "integer"
+                },
+                "replies": {
+                    "type": "integer"
+                },
+                "reply_limit": {
+                    "type": "integer"
+                },
+                "reply_limit_reached": {
+                    "type": "boolean"
+                }
+            }
         }
     },
     "securityDefinitions": {
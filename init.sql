@@ -4,51 +4,160 @@ CREATE TABLE boards (
     slug VARCHAR(10) NOT NULL UNIQUE,
     description TEXT,
     settings JSONB NOT NULL DEFAULT '{}',
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    post_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE posts (
     id SERIAL PRIMARY KEY,
     board_id INTEGER NOT NULL REFERENCES boards(id),
+    number INTEGER NOT NULL,
     thread_id INTEGER REFERENCES posts(id),
     user_id INTEGER,
+    name VARCHAR(75),
+    tripcode VARCHAR(30),
+    capcode VARCHAR(20),
+    poster_id VARCHAR(16),
+    ip_hash VARCHAR(64),
     title VARCHAR(200),
     content TEXT NOT NULL,
+    content_html TEXT NOT NULL DEFAULT '',
     image_url TEXT,
+    spoiler BOOLEAN NOT NULL DEFAULT false,
     metadata JSONB NOT NULL DEFAULT '{}',
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE,
+    edited_at TIMESTAMP WITH TIME ZONE,
     last_bumped_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    archived_at TIMESTAMP WITH TIME ZONE
+    archived_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    sage BOOLEAN NOT NULL DEFAULT false,
+    sticky INTEGER,
+    locked BOOLEAN NOT NULL DEFAULT false,
+    cyclical BOOLEAN NOT NULL DEFAULT false,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    deleted_by INTEGER,
+    delete_reason TEXT,
+    file_deleted_at TIMESTAMP WITH TIME ZONE,
+    delete_password TEXT,
+    UNIQUE (board_id, number)
+);
+
+CREATE TABLE post_quotes (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    board_id INTEGER NOT NULL REFERENCES boards(id),
+    thread_id INTEGER NOT NULL,
+    quoted_post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    quoted_board_id INTEGER NOT NULL REFERENCES boards(id),
+    quoted_thread_id INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, quoted_post_id)
+);
+
+CREATE TABLE post_revisions (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    title VARCHAR(200),
+    content TEXT NOT NULL,
+    content_html TEXT NOT NULL DEFAULT '',
+    edited_by INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (post_id, revision)
+);
+
+CREATE TABLE polls (
+    id SERIAL PRIMARY KEY,
+    thread_id INTEGER NOT NULL UNIQUE REFERENCES posts(id) ON DELETE CASCADE,
+    question VARCHAR(300) NOT NULL,
+    options TEXT[] NOT NULL,
+    multiple BOOLEAN NOT NULL DEFAULT false,
+    closes_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One ballot per voter ("user:<id>" or "ip:<hash>") and per IP hash, so neither logging
+-- in and out nor extra accounts give another vote; choices are option indexes.
+CREATE TABLE poll_votes (
+    poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    voter VARCHAR(80) NOT NULL,
+    ip_hash VARCHAR(64) NOT NULL,
+    choices INTEGER[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (poll_id, voter),
+    UNIQUE (poll_id, ip_hash)
 );
 
 CREATE TABLE flags (
     id SERIAL PRIMARY KEY,
-    post_id INTEGER NOT NULL REFERENCES posts(id),
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
     user_id INTEGER,
     reason TEXT NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Files of purged posts awaiting removal from storage; failed removals are retried.
+CREATE TABLE file_deletions (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 CREATE TABLE users (
     id SERIAL PRIMARY KEY,
     username VARCHAR(50) NOT NULL UNIQUE,
     password TEXT NOT NULL,
     is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'janitor', 'mod', 'admin')),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE events (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    board_id INTEGER NOT NULL REFERENCES boards(id),
+    thread_id INTEGER NOT NULL,
+    post_id INTEGER,
+    payload JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Announce every new event to listening API replicas; delivered on commit.
+CREATE FUNCTION notify_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('noppera_events', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER events_notify AFTER INSERT ON events
+    FOR EACH ROW EXECUTE FUNCTION notify_event();
+
 CREATE INDEX idx_posts_board_id ON posts(board_id);
 CREATE INDEX idx_posts_thread_id ON posts(thread_id);
 CREATE INDEX idx_posts_last_bumped_at ON posts(last_bumped_at);
 CREATE INDEX idx_posts_archived_at ON posts(archived_at);
+CREATE INDEX idx_posts_board_threads ON posts(board_id, last_bumped_at DESC, id DESC) WHERE thread_id IS NULL AND archived_at IS NULL;
+CREATE INDEX idx_posts_board_sticky ON posts(board_id, sticky, id DESC) WHERE thread_id IS NULL AND archived_at IS NULL AND sticky IS NOT NULL;
+CREATE INDEX idx_posts_active_bumped ON posts(last_bumped_at DESC, id DESC) WHERE archived_at IS NULL;
+CREATE INDEX idx_posts_deleted_at ON posts(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_posts_expires_at ON posts(expires_at) WHERE thread_id IS NULL AND expires_at IS NOT NULL;
+CREATE INDEX idx_post_quotes_thread_id ON post_quotes(thread_id);
+CREATE INDEX idx_post_quotes_quoted_thread_id ON post_quotes(quoted_thread_id);
+CREATE INDEX idx_flags_created_at ON flags(created_at DESC, id DESC);
 CREATE INDEX idx_users_username ON users(username);
+CREATE INDEX idx_events_board_id ON events(board_id, id);
+CREATE INDEX idx_events_thread_id ON events(thread_id, id);
+CREATE INDEX idx_events_created_at ON events(created_at);
 CREATE INDEX idx_posts_content_fts ON posts USING GIN (to_tsvector('english', content));
 
 INSERT INTO boards (name, slug, description, settings) VALUES
 ('General', 'g', 'General discussion', '{"max_threads": 100, "max_replies": 500, "max_image_size": 5242880}'),
 ('Tech', 't', 'Technology and gadgets', '{"max_threads": 50, "max_replies": 300, "max_image_size": 3145728}');
 
-INSERT INTO users (username, password, is_admin)
-VALUES ('admin', '$2a$10$3zH0y3zH0y3zH0y3zH0y3u3zH0y3zH0y3zH0y3zH0y3zH0y3zH0y', TRUE)
+INSERT INTO users (username, password, is_admin, role)
+VALUES ('admin', '$2a$10$3zH0y3zH0y3zH0y3zH0y3u3zH0y3zH0y3zH0y3zH0y3zH0y3zH0y', TRUE, 'admin')
 ON CONFLICT (username) DO NOTHING;
\ No newline at end of file
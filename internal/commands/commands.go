@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dice limits keep a single roll cheap to compute and store.
+const (
+	MaxDice     = 100
+	MaxSides    = 1000
+	MaxModifier = 10000
+)
+
+// diceExpr matches NdS with an optional +M or -M modifier; the count defaults to one.
+var diceExpr = regexp.MustCompile(`^(\d*)d(\d+)(?:([+-])(\d+))?$`)
+
+// Result is the outcome of a post command. It is computed once when the post is
+// created and stored with it, so it cannot be changed by editing the post.
+type Result struct {
+	Command  string    `json:"command"`
+	Rolls    []int     `json:"rolls,omitempty"`
+	Modifier int       `json:"modifier,omitempty"`
+	Total    *int      `json:"total,omitempty"`
+	Outcome  string    `json:"outcome,omitempty"`
+	RolledAt time.Time `json:"rolled_at"`
+}
+
+// Run evaluates a post command: "dice NdS[+M]" (or "#dice NdS") rolls dice and
+// "flip" (or "#flip") flips a coin. Randomness comes from crypto/rand.
+func Run(input string) (*Result, error) {
+	fields := strings.Fields(strings.ToLower(strings.TrimSpace(input)))
+	if len(fields) == 0 {
+		return nil, errors.New("Empty command")
+	}
+	name := strings.TrimPrefix(fields[0], "#")
+
+	switch {
+	case name == "flip" && len(fields) == 1:
+		n, err := roll(2)
+		if err != nil {
+			return nil, err
+		}
+		outcome := "heads"
+		if n == 2 {
+			outcome = "tails"
+		}
+		return &Result{Command: "flip", Outcome: outcome, RolledAt: time.Now()}, nil
+	case (name == "dice" || name == "roll") && len(fields) == 2:
+		return rollDice(fields[1])
+	}
+	return nil, fmt.Errorf("Unknown command %q, expected \"dice NdS+M\" or \"flip\"", input)
+}
+
+// rollDice rolls an NdS[+M] expression.
+func rollDice(expr string) (*Result, error) {
+	m := diceExpr.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("Invalid dice %q, expected NdS+M such as 2d6+1", expr)
+	}
+	count := 1
+	if m[1] != "" {
+		count, _ = strconv.Atoi(m[1])
+	}
+	sides, _ := strconv.Atoi(m[2])
+	modifier := 0
+	if m[4] != "" {
+		modifier, _ = strconv.Atoi(m[4])
+		if m[3] == "-" {
+			modifier = -modifier
+		}
+	}
+	if count < 1 || count > MaxDice || sides < 2 || sides > MaxSides || modifier > MaxModifier || modifier < -MaxModifier {
+		return nil, fmt.Errorf("Dice must be 1-%d dice of 2-%d sides with a modifier of at most %d", MaxDice, MaxSides, MaxModifier)
+	}
+
+	result := &Result{Command: "dice " + expr, Rolls: make([]int, count), Modifier: modifier, RolledAt: time.Now()}
+	total := modifier
+	for i := range result.Rolls {
+		n, err := roll(sides)
+		if err != nil {
+			return nil, err
+		}
+		result.Rolls[i] = n
+		total += n
+	}
+	result.Total = &total
+	return result, nil
+}
+
+// roll returns a uniformly distributed number from 1 to sides.
+func roll(sides int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(sides)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to roll: %w", err)
+	}
+	return int(n.Int64()) + 1, nil
+}
@@ -14,6 +14,11 @@ type Config struct {
 	APIPort              string
 	JWTSecret            string
 	JWTExpiry            string
+	TripcodeSecret       string
+	PosterIDSecret       string
+	PosterIDRotation     time.Duration
+	IPHashSecret         string
+	TrustedProxies       string
 	StorageType          string
 	UploadDir            string
 	UploadURLPrefix      string // Added for configurable local storage URL path
@@ -27,10 +32,23 @@ type Config struct {
 	RateLimitBurst       int
 	MaxPostLength        int
 	MaxTags              int
+	DefaultPageSize      int
+	MaxPageSize          int
 	DefaultMaxThreads    int
 	DefaultMaxReplies    int
+	DefaultBumpLimit     int
+	DefaultImageLimit    int
 	DefaultMaxImageSize  int
+	DefaultEditWindow    time.Duration
+	DefaultDeleteWindow  time.Duration
 	ArchiveDeleteDays    int
+	PurgeDeletedDays     int
+	ThreadExpiryInterval time.Duration
+	EventRetentionHours  int
+	SSEHeartbeat         time.Duration
+	WSRateLimitMessages  int
+	WSRateLimitBurst     int
+	CompressionLevel     int
 	LogLevel             string
 	LogFile              string
 	CORSAllowedOrigins   string
@@ -52,6 +70,11 @@ func Load() Config {
 		APIPort:              getEnv("API_PORT", "8080"),
 		JWTSecret:            getEnv("JWT_SECRET", "your-32-byte-secret-here"),
 		JWTExpiry:            getEnv("JWT_EXPIRY", "24h"),
+		TripcodeSecret:       getEnv("TRIPCODE_SECRET", "your-tripcode-secret-here"),
+		PosterIDSecret:       getEnv("POSTER_ID_SECRET", "your-poster-id-secret-here"),
+		PosterIDRotation:     time.Duration(getEnvAsInt("POSTER_ID_ROTATION_HOURS", 24)) * time.Hour,
+		IPHashSecret:         getEnv("IP_HASH_SECRET", "your-ip-hash-secret-here"),
+		TrustedProxies:       getEnv("TRUSTED_PROXIES", ""),
 		StorageType:          getEnv("STORAGE_TYPE", "local"),
 		UploadDir:            getEnv("UPLOAD_DIR", "/uploads"),
 		UploadURLPrefix:      getEnv("UPLOAD_URL_PREFIX", "/uploads"), // Added default
@@ -65,10 +88,23 @@ func Load() Config {
 		RateLimitBurst:       getEnvAsInt("RATE_LIMIT_BURST", 10),
 		MaxPostLength:        getEnvAsInt("MAX_POST_LENGTH", 5000),
 		MaxTags:              getEnvAsInt("MAX_TAGS", 10),
+		DefaultPageSize:      getEnvAsInt("DEFAULT_PAGE_SIZE", 50),
+		MaxPageSize:          getEnvAsInt("MAX_PAGE_SIZE", 100),
 		DefaultMaxThreads:    getEnvAsInt("DEFAULT_MAX_THREADS", 100),
 		DefaultMaxReplies:    getEnvAsInt("DEFAULT_MAX_REPLIES", 500),
+		DefaultBumpLimit:     getEnvAsInt("DEFAULT_BUMP_LIMIT", 300),
+		DefaultImageLimit:    getEnvAsInt("DEFAULT_IMAGE_LIMIT", 150),
 		DefaultMaxImageSize:  getEnvAsInt("DEFAULT_MAX_IMAGE_SIZE", 5242880),
+		DefaultEditWindow:    time.Duration(getEnvAsInt("DEFAULT_EDIT_WINDOW_SECONDS", 900)) * time.Second,
+		DefaultDeleteWindow:  time.Duration(getEnvAsInt("DEFAULT_DELETE_WINDOW_SECONDS", 86400)) * time.Second,
 		ArchiveDeleteDays:    getEnvAsInt("ARCHIVE_DELETE_DAYS", 30),
+		PurgeDeletedDays:     getEnvAsInt("PURGE_DELETED_DAYS", 7),
+		ThreadExpiryInterval: time.Duration(getEnvAsMinInt("THREAD_EXPIRY_INTERVAL_SECONDS", 60, 1)) * time.Second, // @every needs a positive interval
+		EventRetentionHours:  getEnvAsInt("EVENT_RETENTION_HOURS", 24),
+		SSEHeartbeat:         time.Duration(getEnvAsInt("SSE_HEARTBEAT_SECONDS", 15)) * time.Second,
+		WSRateLimitMessages:  getEnvAsInt("WS_RATE_LIMIT_MESSAGES", 60),
+		WSRateLimitBurst:     getEnvAsInt("WS_RATE_LIMIT_BURST", 10),
+		CompressionLevel:     getEnvAsInt("COMPRESSION_LEVEL", 6),
 		LogLevel:             getEnv("LOG_LEVEL", "info"),
 		LogFile:              getEnv("LOG_FILE", "stdout"),
 		CORSAllowedOrigins:   getEnv("CORS_ALLOWED_ORIGINS", "*"),
@@ -95,3 +131,14 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvAsMinInt retrieves an environment variable as an integer like getEnvAsInt,
+// raising values below min to min with a warning.
+func getEnvAsMinInt(key string, defaultValue, min int) int {
+	value := getEnvAsInt(key, defaultValue)
+	if value < min {
+		fmt.Fprintf(os.Stderr, "Config: %s must be at least %d, got %d; using %d\n", key, min, value, min)
+		return min
+	}
+	return value
+}
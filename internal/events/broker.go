@@ -0,0 +1,249 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cobalto/noppera/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// subscriptionBuffer is how many events a subscriber may fall behind before it is dropped.
+	subscriptionBuffer = 64
+	// reconnectDelay is how long the broker waits before re-establishing LISTEN.
+	reconnectDelay = 2 * time.Second
+	// catchUpBatch bounds how many missed events are loaded per query after a reconnect.
+	catchUpBatch = 500
+)
+
+// Broker fans out events announced through Postgres LISTEN/NOTIFY to local subscribers,
+// so every API replica sees changes made by any other.
+type Broker struct {
+	db     *pgxpool.Pool
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	lastID int64
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Subscription receives events for a set of boards and threads.
+type Subscription struct {
+	events  chan models.Event
+	boards  map[int]struct{}
+	threads map[int]struct{}
+}
+
+// NewBroker creates a new Broker instance.
+func NewBroker(db *pgxpool.Pool) *Broker {
+	return &Broker{
+		db:   db,
+		subs: make(map[*Subscription]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Start begins listening for event notifications.
+func (b *Broker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	if id, err := models.LatestEventID(ctx, b.db); err == nil {
+		b.lastID = id
+	} else {
+		log.Error().Err(err).Msg("Broker: failed to load latest event")
+	}
+	go b.run(ctx)
+}
+
+// Stop stops listening and closes all subscriptions.
+func (b *Broker) Stop() {
+	if b.cancel != nil {
+		b.cancel()
+		<-b.done
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Subscribe registers a subscription for events on any of the given boards or threads.
+func (b *Broker) Subscribe(boardIDs, threadIDs []int) *Subscription {
+	sub := &Subscription{
+		events:  make(chan models.Event, subscriptionBuffer),
+		boards:  make(map[int]struct{}),
+		threads: make(map[int]struct{}),
+	}
+	for _, id := range boardIDs {
+		sub.boards[id] = struct{}{}
+	}
+	for _, id := range threadIDs {
+		sub.threads[id] = struct{}{}
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes a subscription and closes its channel.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Add extends a subscription with more boards and threads. It returns false if the
+// subscription has already been removed or dropped.
+func (b *Broker) Add(sub *Subscription, boardIDs, threadIDs []int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; !ok {
+		return false
+	}
+	for _, id := range boardIDs {
+		sub.boards[id] = struct{}{}
+	}
+	for _, id := range threadIDs {
+		sub.threads[id] = struct{}{}
+	}
+	return true
+}
+
+// Remove stops delivering events for the given boards and threads to a subscription.
+func (b *Broker) Remove(sub *Subscription, boardIDs, threadIDs []int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, id := range boardIDs {
+		delete(sub.boards, id)
+	}
+	for _, id := range threadIDs {
+		delete(sub.threads, id)
+	}
+}
+
+// Size returns how many boards and threads a subscription currently covers.
+func (b *Broker) Size(sub *Subscription) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(sub.boards) + len(sub.threads)
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription is removed or dropped for falling too far behind.
+func (s *Subscription) Events() <-chan models.Event {
+	return s.events
+}
+
+// matches reports whether the event belongs to a subscribed board or thread.
+func (s *Subscription) matches(ev models.Event) bool {
+	if _, ok := s.boards[ev.BoardID]; ok {
+		return true
+	}
+	_, ok := s.threads[ev.ThreadID]
+	return ok
+}
+
+// run keeps a LISTEN connection open until the context is cancelled.
+func (b *Broker) run(ctx context.Context) {
+	defer close(b.done)
+	for {
+		if err := b.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("Broker: lost event listener connection")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// listen subscribes to the event channel and dispatches notifications as they arrive.
+func (b *Broker) listen(ctx context.Context) error {
+	conn, err := b.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+models.EventChannel); err != nil {
+		return err
+	}
+	// Deliver anything committed while the listener was down
+	b.catchUp(ctx)
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			// Do not hand a connection that is still listening back to the pool
+			conn.Conn().Close(context.Background())
+			return err
+		}
+		id, err := strconv.ParseInt(n.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+		ev, err := models.GetEvent(ctx, b.db, id)
+		if err != nil {
+			log.Error().Err(err).Int64("event_id", id).Msg("Broker: failed to load event")
+			continue
+		}
+		b.dispatch(*ev)
+	}
+}
+
+// catchUp dispatches events recorded after the last one seen.
+func (b *Broker) catchUp(ctx context.Context) {
+	for {
+		b.mu.Lock()
+		lastID := b.lastID
+		b.mu.Unlock()
+
+		events, err := models.ListEventsSince(ctx, b.db, lastID, catchUpBatch)
+		if err != nil {
+			log.Error().Err(err).Msg("Broker: failed to catch up on events")
+			return
+		}
+		for _, ev := range events {
+			b.dispatch(ev)
+		}
+		if len(events) < catchUpBatch {
+			return
+		}
+	}
+}
+
+// dispatch delivers an event to every matching subscriber, dropping subscribers
+// whose buffers are full so a slow consumer never blocks the others. Events commit
+// in ID order, so one at or below the last dispatched ID was already delivered by a
+// catch-up and is skipped.
+func (b *Broker) dispatch(ev models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ev.ID <= b.lastID {
+		return
+	}
+	b.lastID = ev.ID
+	for sub := range b.subs {
+		if !sub.matches(ev) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			delete(b.subs, sub)
+			close(sub.events)
+		}
+	}
+}
@@ -19,6 +19,13 @@ func RegisterAuth(r *chi.Mux, db *pgxpool.Pool, cfg config.Config) {
 	r.Post("/auth/register", register(db))
 	r.Post("/auth/login", login(db, cfg))
 	r.With(middleware.Auth(cfg), middleware.AdminOnly).Post("/auth/register/admin", registerAdmin(db))
+	r.With(middleware.Auth(cfg), middleware.AdminOnly).Put("/users/{userID}/role", setUserRole(db))
+}
+
+// credentials is the request body for registering and logging in.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 // register handles POST /auth/register, creating a new user.
@@ -27,31 +34,30 @@ func RegisterAuth(r *chi.Mux, db *pgxpool.Pool, cfg config.Config) {
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param user body models.User true "User registration data"
-// @Success 201 {object} map[string]interface{} "User created successfully"
+// @Param user body object{username=string,password=string} true "User registration data"
+// @Success 201 {object} UserView "User created successfully"
 // @Failure 400 {string} string "Invalid request body"
 // @Failure 500 {string} string "Failed to create user"
 // @Router /auth/register [post]
 func register(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var user models.User
-		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		var input credentials
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
-		if user.Username == "" || user.Password == "" {
+		if input.Username == "" || input.Password == "" {
 			http.Error(w, "Username and password required", http.StatusBadRequest)
 			return
 		}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 		if err != nil {
 			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 			return
 		}
-		user.Password = string(hashedPassword)
-		user.IsAdmin = false
+		user := models.User{Username: input.Username, Password: string(hashedPassword), IsAdmin: false, Role: models.RoleUser}
 
 		ctx := r.Context()
 		if err := models.CreateUser(ctx, db, &user); err != nil {
@@ -60,10 +66,7 @@ func register(db *pgxpool.Pool) http.HandlerFunc {
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":       user.ID,
-			"username": user.Username,
-		})
+		json.NewEncoder(w).Encode(newUserView(&user))
 	}
 }
 
@@ -81,10 +84,7 @@ func register(db *pgxpool.Pool) http.HandlerFunc {
 // @Router /auth/login [post]
 func login(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var creds struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
-		}
+		var creds credentials
 		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
@@ -113,6 +113,7 @@ func login(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 			ID:       user.ID,
 			Username: user.Username,
 			IsAdmin:  user.IsAdmin,
+			Role:     user.Role,
 			RegisteredClaims: jwt.RegisteredClaims{
 				ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 				IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -136,8 +137,8 @@ func login(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param user body models.User true "Admin user registration data"
-// @Success 201 {object} map[string]interface{} "Admin user created successfully"
+// @Param user body object{username=string,password=string} true "Admin user registration data"
+// @Success 201 {object} UserView "Admin user created successfully"
 // @Failure 400 {string} string "Invalid request body"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 403 {string} string "Admin access required"
@@ -145,24 +146,23 @@ func login(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 // @Router /auth/register/admin [post]
 func registerAdmin(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var user models.User
-		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		var input credentials
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
-		if user.Username == "" || user.Password == "" {
+		if input.Username == "" || input.Password == "" {
 			http.Error(w, "Username and password required", http.StatusBadRequest)
 			return
 		}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 		if err != nil {
 			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 			return
 		}
-		user.Password = string(hashedPassword)
-		user.IsAdmin = true
+		user := models.User{Username: input.Username, Password: string(hashedPassword), IsAdmin: true, Role: models.RoleAdmin}
 
 		ctx := r.Context()
 		if err := models.CreateUser(ctx, db, &user); err != nil {
@@ -171,10 +171,51 @@ func registerAdmin(db *pgxpool.Pool) http.HandlerFunc {
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":       user.ID,
-			"username": user.Username,
-			"is_admin": user.IsAdmin,
-		})
+		json.NewEncoder(w).Encode(newUserView(&user))
+	}
+}
+
+// setUserRole handles PUT /users/{userID}/role, changing a user's role.
+// @Summary Set user role
+// @Description Make a user a janitor, mod or admin (or a plain user again). Staff roles may post with a matching capcode; mods and admins get moderator access, and only admins get admin access. Takes effect at the user's next login. Admin only.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param userID path int true "User ID"
+// @Param role body object{role=string} true "New role: user, janitor, mod or admin"
+// @Success 200 {object} UserView "Updated user"
+// @Failure 400 {string} string "Invalid user ID or role"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Admin access required"
+// @Failure 404 {string} string "User not found"
+// @Failure 500 {string} string "Failed to set role"
+// @Router /users/{userID}/role [put]
+func setUserRole(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := parseInt(chi.URLParam(r, "userID"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var input struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || !models.ValidRole(input.Role) {
+			http.Error(w, "Invalid role", http.StatusBadRequest)
+			return
+		}
+
+		user, err := models.SetUserRole(r.Context(), db, userID, input.Role)
+		if err != nil {
+			if err.Error() == "user not found" {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to set role", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(newUserView(user))
 	}
 }
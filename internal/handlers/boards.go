@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/cobalto/noppera/internal/config"
 	"github.com/cobalto/noppera/internal/middleware"
 	"github.com/cobalto/noppera/internal/models"
 	"github.com/cobalto/noppera/internal/storage"
@@ -14,26 +15,47 @@ import (
 
 // RegisterBoards sets up board-related routes.
 func RegisterBoards(r chi.Router, db *pgxpool.Pool, store storage.Storage) {
-	r.Get("/boards", listBoards(db))
+	r.Get("/boards", listBoards(db, store.Config()))
 	r.With(middleware.Auth(store.Config()), middleware.AdminOnly).Post("/boards", createBoard(db))
 }
 
-// listBoards handles GET /boards, listing all boards.
+// listBoards handles GET /boards?cursor={cursor}&limit={n}, listing boards a page at a time.
 // @Summary List boards
-// @Description Get all available boards
+// @Description Get available boards, paginated by cursor
 // @Tags boards
 // @Produce json
-// @Success 200 {array} models.Board "List of boards"
+// @Param cursor query string false "Cursor from a previous page's next_cursor"
+// @Param limit query int false "Page size"
+// @Param If-None-Match header string false "ETag of a cached response"
+// @Param If-Modified-Since header string false "Last-Modified of a cached response"
+// @Success 200 {object} PageResponse[models.Board] "Page of boards"
+// @Success 304 {string} string "Not modified"
+// @Failure 400 {string} string "Invalid cursor or limit"
 // @Failure 500 {string} string "Failed to list boards"
 // @Router /boards [get]
-func listBoards(db *pgxpool.Pool) http.HandlerFunc {
+func listBoards(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		boards, err := models.ListBoards(r.Context(), db)
+		after, limit, err := parsePage(r, cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		boardCount, lastModified, err := models.BoardsVersion(r.Context(), db)
+		if err != nil {
+			http.Error(w, "Failed to list boards", http.StatusInternalServerError)
+			return
+		}
+		if notModified(w, r, makeETag("boards", r.URL.RawQuery, boardCount, lastModified.UnixNano()), lastModified) {
+			return
+		}
+
+		boards, next, err := models.ListBoards(r.Context(), db, after, limit)
 		if err != nil {
 			http.Error(w, "Failed to list boards", http.StatusInternalServerError)
 			return
 		}
-		json.NewEncoder(w).Encode(boards)
+		json.NewEncoder(w).Encode(newPageResponse(boards, next))
 	}
 }
 
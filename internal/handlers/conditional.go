@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// makeETag derives a strong entity tag from the values that identify a response version.
+func makeETag(parts ...interface{}) string {
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%v|", part)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified sets the ETag and Last-Modified validators and, if the client's cached
+// copy is still current, writes a 304 response and returns true. If-None-Match takes
+// precedence over If-Modified-Since as required by RFC 9110.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	// Responses that differ by caller set their own, private, cache policy
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err != nil || lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header matches the entity tag, using
+// weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/events"
+	"github.com/cobalto/noppera/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// replayBatch bounds how many missed events are loaded per query on resumption.
+const replayBatch = 500
+
+// RegisterEvents sets up live event stream routes.
+func RegisterEvents(r chi.Router, db *pgxpool.Pool, broker *events.Broker, cfg config.Config) {
+	r.Get("/threads/{threadID}/events", streamThreadEvents(db, broker, cfg))
+	r.Get("/boards/{boardSlug}/events", streamBoardEvents(db, broker, cfg))
+}
+
+// streamThreadEvents handles GET /threads/{threadID}/events, streaming thread updates as Server-Sent Events.
+// @Summary Stream thread events
+// @Description Stream new replies, deletions and state changes of a thread as Server-Sent Events. Resume with the Last-Event-ID header or last_event_id query parameter.
+// @Tags events
+// @Produce text/event-stream
+// @Param threadID path int true "Thread ID"
+// @Param Last-Event-ID header int false "Last event ID received"
+// @Param last_event_id query int false "Last event ID received"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {string} string "Invalid thread ID"
+// @Failure 404 {string} string "Thread not found or archived"
+// @Router /threads/{threadID}/events [get]
+func streamThreadEvents(db *pgxpool.Pool, broker *events.Broker, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		threadID, err := parseInt(chi.URLParam(r, "threadID"))
+		if err != nil {
+			http.Error(w, "Invalid thread ID", http.StatusBadRequest)
+			return
+		}
+
+		thread, err := models.GetPost(r.Context(), db, threadID)
+		if err != nil || thread.ThreadID != nil || thread.ArchivedAt != nil || thread.Deleted || thread.Expired() {
+			http.Error(w, "Thread not found or archived", http.StatusNotFound)
+			return
+		}
+
+		streamEvents(w, r, db, broker, cfg, nil, []int{threadID})
+	}
+}
+
+// streamBoardEvents handles GET /boards/{boardSlug}/events, streaming board activity as Server-Sent Events.
+// @Summary Stream board events
+// @Description Stream new threads, replies, deletions and thread state changes on a board as Server-Sent Events. Resume with the Last-Event-ID header or last_event_id query parameter.
+// @Tags events
+// @Produce text/event-stream
+// @Param boardSlug path string true "Board slug"
+// @Param Last-Event-ID header int false "Last event ID received"
+// @Param last_event_id query int false "Last event ID received"
+// @Success 200 {string} string "Event stream"
+// @Failure 404 {string} string "Board not found"
+// @Router /boards/{boardSlug}/events [get]
+func streamBoardEvents(db *pgxpool.Pool, broker *events.Broker, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		board, err := models.GetBoardBySlug(r.Context(), db, chi.URLParam(r, "boardSlug"))
+		if err != nil {
+			http.Error(w, "Board not found", http.StatusNotFound)
+			return
+		}
+
+		streamEvents(w, r, db, broker, cfg, []int{board.ID}, nil)
+	}
+}
+
+// streamEvents writes missed events since Last-Event-ID followed by live events until
+// the client disconnects, sending heartbeat comments to keep idle connections open.
+func streamEvents(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, broker *events.Broker, cfg config.Config, boardIDs, threadIDs []int) {
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+
+	lastID := lastEventID(r)
+
+	// Subscribe before replaying so nothing committed in between is lost
+	sub := broker.Subscribe(boardIDs, threadIDs)
+	defer broker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if lastID > 0 {
+		for {
+			missed, err := models.ListEvents(ctx, db, lastID, boardIDs, threadIDs, replayBatch)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to replay events")
+				return
+			}
+			for _, ev := range missed {
+				if err := writeEvent(w, ev); err != nil {
+					return
+				}
+				lastID = ev.ID
+			}
+			if len(missed) < replayBatch {
+				break
+			}
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(cfg.SSEHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub.Events():
+			if !ok {
+				// Dropped for falling behind; the client reconnects with Last-Event-ID
+				return
+			}
+			if ev.ID <= lastID {
+				continue
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+			lastID = ev.ID
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// lastEventID reads the resumption point from the Last-Event-ID header or the
+// last_event_id query parameter, which browsers can set on the first connection.
+func lastEventID(r *http.Request) int64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
+// writeEvent writes a single event in Server-Sent Events format.
+func writeEvent(w http.ResponseWriter, ev models.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
+
+// publishEvent records an event for live subscribers. Failures are only logged
+// because the change that triggered the event has already been committed.
+func publishEvent(ctx context.Context, db *pgxpool.Pool, eventType string, boardID, threadID int, postID *int, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Str("type", eventType).Msg("Failed to encode event payload")
+		return
+	}
+	event := models.Event{
+		Type:     eventType,
+		BoardID:  boardID,
+		ThreadID: threadID,
+		PostID:   postID,
+		Payload:  data,
+	}
+	if err := models.CreateEvent(ctx, db, &event); err != nil {
+		log.Error().Err(err).Str("type", eventType).Msg("Failed to publish event")
+	}
+}
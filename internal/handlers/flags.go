@@ -14,8 +14,8 @@ import (
 
 // RegisterFlags sets up flag-related routes.
 func RegisterFlags(r chi.Router, db *pgxpool.Pool, cfg config.Config) {
-	r.Post("/posts/{postID}/flag", flagPost(db, cfg))
-	r.With(middleware.Auth(cfg), middleware.AdminOnly).Get("/flags", listFlags(db))
+	r.With(middleware.OptionalAuth(cfg)).Post("/posts/{postID}/flag", flagPost(db, cfg))
+	r.With(middleware.Auth(cfg), middleware.ModOnly).Get("/flags", listFlags(db, cfg))
 }
 
 // flagPost handles POST /posts/{postID}/flag, allowing users or anonymous to flag a post.
@@ -63,15 +63,21 @@ func flagPost(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 	}
 }
 
-// listFlags handles GET /flags, returning all flags for admin review.
-func listFlags(db *pgxpool.Pool) http.HandlerFunc {
+// listFlags handles GET /flags?cursor={cursor}&limit={n}, returning flags for moderator review a page at a time.
+func listFlags(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
-		flags, err := models.ListFlags(ctx, db)
+		after, limit, err := parsePage(r, cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		flags, next, err := models.ListFlags(ctx, db, after, limit)
 		if err != nil {
 			http.Error(w, "Failed to list flags", http.StatusInternalServerError)
 			return
 		}
-		json.NewEncoder(w).Encode(flags)
+		json.NewEncoder(w).Encode(newPageResponse(flags, next))
 	}
 }
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/models"
+)
+
+// PageResponse is one page of a list endpoint. NextCursor is passed back as the cursor
+// query parameter to fetch the following page and is omitted on the last page.
+type PageResponse[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// newPageResponse builds a page, encoding the next cursor and never returning null items.
+func newPageResponse[T any](items []T, next *models.Cursor) PageResponse[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return PageResponse[T]{Items: items, NextCursor: encodeCursor(next)}
+}
+
+// parsePage reads the cursor and limit query parameters, applying the configured
+// default and maximum page sizes.
+func parsePage(r *http.Request, cfg config.Config) (*models.Cursor, int, error) {
+	limit := cfg.DefaultPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := parseInt(value)
+		if err != nil || n < 1 {
+			return nil, 0, errors.New("Invalid limit")
+		}
+		limit = n
+	}
+	if limit > cfg.MaxPageSize {
+		limit = cfg.MaxPageSize
+	}
+
+	after, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		return nil, 0, errors.New("Invalid cursor")
+	}
+	return after, limit, nil
+}
+
+// encodeCursor turns a keyset position into an opaque token.
+func encodeCursor(c *models.Cursor) string {
+	if c == nil {
+		return ""
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a token produced by encodeCursor; an empty token means the first page.
+func decodeCursor(token string) (*models.Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var c models.Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
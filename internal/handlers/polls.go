@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/middleware"
+	"github.com/cobalto/noppera/internal/models"
+	"github.com/cobalto/noppera/internal/tripcode"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Poll size limits.
+const (
+	minPollOptions     = 2
+	maxPollOptions     = 10
+	maxPollQuestionLen = 300
+	maxPollOptionLen   = 200
+)
+
+// RegisterPolls sets up poll-related routes.
+func RegisterPolls(r chi.Router, db *pgxpool.Pool, cfg config.Config) {
+	r.With(middleware.OptionalAuth(cfg)).Post("/threads/{threadID}/poll/votes", votePoll(db, cfg))
+}
+
+// pollInput is a poll attached to a new thread.
+type pollInput struct {
+	Question string     `json:"question"`
+	Options  []string   `json:"options"`
+	Multiple bool       `json:"multiple"`
+	ClosesAt *time.Time `json:"closes_at"`
+}
+
+// newPoll validates a poll attached to a new thread.
+func newPoll(input *pollInput) (*models.Poll, error) {
+	question := strings.TrimSpace(input.Question)
+	if question == "" || len(question) > maxPollQuestionLen {
+		return nil, fmt.Errorf("Poll question is required and must be at most %d characters", maxPollQuestionLen)
+	}
+	if len(input.Options) < minPollOptions || len(input.Options) > maxPollOptions {
+		return nil, fmt.Errorf("Polls must have between %d and %d options", minPollOptions, maxPollOptions)
+	}
+	if input.ClosesAt != nil && !input.ClosesAt.After(time.Now()) {
+		return nil, errors.New("Poll close time must be in the future")
+	}
+
+	poll := &models.Poll{
+		Question: question,
+		Options:  make([]models.PollOption, len(input.Options)),
+		Multiple: input.Multiple,
+		ClosesAt: input.ClosesAt,
+	}
+	for i, text := range input.Options {
+		text = strings.TrimSpace(text)
+		if text == "" || len(text) > maxPollOptionLen {
+			return nil, fmt.Errorf("Poll options are required and must be at most %d characters", maxPollOptionLen)
+		}
+		poll.Options[i].Text = text
+	}
+	return poll, nil
+}
+
+// votePoll handles POST /threads/{threadID}/poll/votes, casting a ballot in a thread's poll.
+// @Summary Vote in poll
+// @Description Vote in a thread's poll by option index: exactly one option for single-choice polls, one or more for multiple-choice polls. Each account and each IP may vote once, so a logged-in vote also uses up the IP's vote and vice versa. Closed polls, and polls in archived threads, no longer accept votes.
+// @Tags polls
+// @Accept json
+// @Produce json
+// @Param threadID path int true "Thread ID"
+// @Param ballot body object{options=[]int} true "Indexes of the chosen options"
+// @Success 200 {object} models.Poll "Poll with updated tallies"
+// @Failure 400 {string} string "Invalid thread ID or choices"
+// @Failure 403 {string} string "Poll is closed"
+// @Failure 404 {string} string "Poll not found"
+// @Failure 409 {string} string "Already voted"
+// @Failure 500 {string} string "Failed to vote"
+// @Router /threads/{threadID}/poll/votes [post]
+func votePoll(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		threadID, err := parseInt(chi.URLParam(r, "threadID"))
+		if err != nil {
+			http.Error(w, "Invalid thread ID", http.StatusBadRequest)
+			return
+		}
+
+		var input struct {
+			Options []int `json:"options"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		poll, err := models.GetPollByThread(ctx, db, threadID)
+		if err != nil {
+			http.Error(w, "Failed to vote", http.StatusInternalServerError)
+			return
+		}
+		if poll == nil {
+			http.Error(w, "Poll not found", http.StatusNotFound)
+			return
+		}
+		if len(input.Options) == 0 || (!poll.Multiple && len(input.Options) > 1) {
+			http.Error(w, "Choose one option, or several in multiple-choice polls", http.StatusBadRequest)
+			return
+		}
+		seen := make(map[int]bool)
+		for _, choice := range input.Options {
+			if choice < 0 || choice >= len(poll.Options) || seen[choice] {
+				http.Error(w, "Invalid or repeated option", http.StatusBadRequest)
+				return
+			}
+			seen[choice] = true
+		}
+
+		ipHash := tripcode.IPHash(middleware.ClientIP(r), cfg.IPHashSecret)
+		voter := "ip:" + ipHash
+		if userID := getUserID(r); userID != nil {
+			voter = fmt.Sprintf("user:%d", *userID)
+		}
+		if err := models.Vote(ctx, db, poll.ID, voter, ipHash, input.Options); err != nil {
+			switch err.Error() {
+			case "already voted":
+				http.Error(w, "Already voted", http.StatusConflict)
+			case "poll closed":
+				http.Error(w, "Poll is closed", http.StatusForbidden)
+			default:
+				http.Error(w, "Failed to vote", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		poll, err = models.GetPollByThread(ctx, db, threadID)
+		if err != nil || poll == nil {
+			http.Error(w, "Failed to vote", http.StatusInternalServerError)
+			return
+		}
+		thread, err := models.GetPost(ctx, db, threadID)
+		if err == nil {
+			publishEvent(ctx, db, models.EventPollUpdated, thread.BoardID, threadID, nil, poll)
+		}
+
+		json.NewEncoder(w).Encode(poll)
+	}
+}
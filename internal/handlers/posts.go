@@ -1,39 +1,65 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/cobalto/noppera/internal/commands"
+	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/markup"
 	"github.com/cobalto/noppera/internal/middleware"
 	"github.com/cobalto/noppera/internal/models"
+	"github.com/cobalto/noppera/internal/purge"
 	"github.com/cobalto/noppera/internal/storage"
+	"github.com/cobalto/noppera/internal/tripcode"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// maxDeletePasswordLength is the longest delete password bcrypt can hash.
+const maxDeletePasswordLength = 72
+
+// tokenHashPrefix marks a stored delete password as the SHA-256 hash of a generated
+// token rather than the bcrypt hash of a password the poster chose.
+const tokenHashPrefix = "sha256:"
+
 // RegisterPosts sets up post-related routes.
 func RegisterPosts(r chi.Router, db *pgxpool.Pool, store storage.Storage) {
-	r.Post("/boards/{boardSlug}/threads", createThread(db, store))
-	r.Post("/threads/{threadID}/replies", createReply(db, store))
+	r.With(middleware.OptionalAuth(store.Config())).Post("/boards/{boardSlug}/threads", createThread(db, store))
+	r.With(middleware.OptionalAuth(store.Config())).Post("/threads/{threadID}/replies", createReply(db, store))
+	r.Delete("/posts/{postID}", deletePostPassword(db, store.Config()))
 	r.With(middleware.Auth(store.Config())).Delete("/posts/{postID}/user", deletePostUser(db))
-	r.With(middleware.Auth(store.Config()), middleware.AdminOnly).Delete("/posts/{postID}/admin", deletePostAdmin(db, store))
+	r.With(middleware.Auth(store.Config()), middleware.ModOnly).Delete("/posts/{postID}/admin", deletePostAdmin(db))
+	r.With(middleware.Auth(store.Config()), middleware.ModOnly).Delete("/posts/{postID}/file", deletePostFile(db, store))
+	r.With(middleware.Auth(store.Config()), middleware.AdminOnly).Delete("/posts/{postID}/purge", purgePost(db, store))
+	r.With(middleware.Auth(store.Config())).Put("/posts/{postID}", editPost(db, store.Config()))
+	r.With(middleware.Auth(store.Config()), middleware.ModOnly).Get("/posts/{postID}/revisions", listRevisions(db))
 }
 
 // createThread handles POST /boards/{boardSlug}/threads, creating a new thread.
 // @Summary Create thread
-// @Description Create a new thread in a board
+// @Description Create a new thread in a board. A valid bearer token is optional and attributes the thread to the user.
 // @Tags posts
 // @Accept json
 // @Produce json
 // @Param boardSlug path string true "Board slug"
-// @Param thread body object{title=string,content=string,image=string,tags=[]string,metadata=object} true "Thread data"
-// @Success 201 {object} models.Post "Thread created successfully"
+// @Param thread body object{name=string,title=string,content=string,image=string,tags=[]string,metadata=object,password=string,spoiler=bool,command=string,capcode=string,expires_in=int,poll=object{question=string,options=[]string,multiple=bool,closes_at=string}} true "Thread data (name may include #password or ##password for a tripcode; password is an optional delete password; spoiler hides the image behind a placeholder and defaults to the board's spoiler_by_default; command runs a server-side command such as "dice 2d6+1" or "#flip"; capcode requires a staff token; expires_in is an optional lifetime in seconds, capped by the board's thread_lifetime; poll is optional)"
+// @Success 201 {object} PostView "Thread created successfully, with a delete_token if no password was given"
 // @Failure 400 {string} string "Invalid request body"
 // @Failure 404 {string} string "Board not found"
-// @Failure 403 {string} string "Thread limit reached"
+// @Failure 403 {string} string "Thread limit reached (boards with the reject policy, or full of sticky threads)"
 // @Failure 500 {string} string "Failed to create thread"
 // @Router /boards/{boardSlug}/threads [post]
 func createThread(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
@@ -43,11 +69,18 @@ func createThread(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
 		cfg := store.Config()
 
 		var input struct {
-			Title    string                 `json:"title"`
-			Content  string                 `json:"content"`
-			Image    string                 `json:"image"`
-			Tags     []string               `json:"tags"`
-			Metadata map[string]interface{} `json:"metadata"`
+			Name      string                 `json:"name"`
+			Title     string                 `json:"title"`
+			Content   string                 `json:"content"`
+			Image     string                 `json:"image"`
+			Tags      []string               `json:"tags"`
+			Metadata  map[string]interface{} `json:"metadata"`
+			Password  string                 `json:"password"`
+			Poll      *pollInput             `json:"poll"`
+			Spoiler   *bool                  `json:"spoiler"`
+			Command   string                 `json:"command"`
+			Capcode   string                 `json:"capcode"`
+			ExpiresIn int                    `json:"expires_in"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -62,27 +95,46 @@ func createThread(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
 			http.Error(w, fmt.Sprintf("Too many tags, maximum is %d", cfg.MaxTags), http.StatusBadRequest)
 			return
 		}
+		if len(input.Password) > maxDeletePasswordLength {
+			http.Error(w, fmt.Sprintf("Delete password is too long, maximum is %d bytes", maxDeletePasswordLength), http.StatusBadRequest)
+			return
+		}
+		if input.ExpiresIn < 0 {
+			http.Error(w, "Expiry must be a positive number of seconds", http.StatusBadRequest)
+			return
+		}
+		var poll *models.Poll
+		if input.Poll != nil {
+			var err error
+			if poll, err = newPoll(input.Poll); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		user := getUser(r)
+		capcode, err := verifyCapcode(input.Capcode, user)
+		if err != nil {
+			writePostError(w, err)
+			return
+		}
 
 		// Get board and validate settings
 		var board models.Board
-		err := db.QueryRow(ctx, "SELECT id, settings FROM boards WHERE slug = $1", boardSlug).Scan(&board.ID, &board.Settings)
+		err = db.QueryRow(ctx, "SELECT id, settings FROM boards WHERE slug = $1", boardSlug).Scan(&board.ID, &board.Settings)
 		if err != nil {
 			http.Error(w, "Board not found", http.StatusNotFound)
 			return
 		}
 
-		maxThreads := cfg.DefaultMaxThreads
-		if val, ok := board.Settings["max_threads"]; ok {
-			if mt, ok := val.(float64); ok {
-				maxThreads = int(mt)
+		// Full boards archive their oldest threads to make room unless set to reject. The
+		// count is rechecked under lock, this only saves an upload that would be refused.
+		if board.StringSetting("thread_limit_policy", "prune") != "prune" {
+			threadCount, err := models.CountThreads(ctx, db, board.ID)
+			if err != nil || threadCount >= board.IntSetting("max_threads", cfg.DefaultMaxThreads) {
+				http.Error(w, "Thread limit reached for this board", http.StatusForbidden)
+				return
 			}
 		}
-		var threadCount int
-		err = db.QueryRow(ctx, "SELECT COUNT(*) FROM posts WHERE board_id = $1 AND thread_id IS NULL AND archived_at IS NULL", board.ID).Scan(&threadCount)
-		if err != nil || threadCount >= maxThreads {
-			http.Error(w, "Thread limit reached for this board", http.StatusForbidden)
-			return
-		}
 
 		var imageURL *string
 		if input.Image != "" {
@@ -103,148 +155,364 @@ func createThread(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
 			imageURL = &url
 		}
 
-		userID := getUserID(r)
-		if input.Metadata == nil {
-			input.Metadata = make(map[string]interface{})
-		}
-		if len(input.Tags) > 0 {
-			input.Metadata["tags"] = input.Tags
+		metadata := newMetadata(input.Metadata, input.Tags)
+		if err := runCommand(metadata, input.Command, &board); err != nil {
+			discardUpload(ctx, store, imageURL)
+			writePostError(w, err)
+			return
 		}
 
+		ip := middleware.ClientIP(r)
+		ipHash := tripcode.IPHash(ip, cfg.IPHashSecret)
 		post := models.Post{
 			BoardID:      board.ID,
-			UserID:       userID,
+			UserID:       getUserID(r),
+			Capcode:      capcode,
+			IPHash:       &ipHash,
 			Title:        &input.Title,
 			Content:      input.Content,
 			ImageURL:     imageURL,
-			Metadata:     input.Metadata,
+			Spoiler:      spoilerImage(imageURL, input.Spoiler, &board),
+			Metadata:     metadata,
 			CreatedAt:    time.Now(),
 			LastBumpedAt: time.Now(),
+			Poll:         poll,
 		}
+		post.ExpiresAt = threadExpiry(&board, input.ExpiresIn, post.CreatedAt)
 
-		if err := models.CreatePost(ctx, db, &post); err != nil {
+		setPosterName(&post, input.Name, &board, cfg)
+		renderContent(ctx, db, &post, &board)
+		deleteToken, err := setDeletePassword(&post, input.Password)
+		if err != nil {
+			discardUpload(ctx, store, imageURL)
 			http.Error(w, "Failed to create thread", http.StatusInternalServerError)
 			return
 		}
 
+		pruned, err := insertThread(ctx, db, &post, &board, cfg, ip)
+		if err != nil {
+			discardUpload(ctx, store, imageURL)
+			writePostError(w, err)
+			return
+		}
+		for i := range pruned {
+			publishEvent(ctx, db, models.EventThreadUpdated, pruned[i].BoardID, pruned[i].ID, nil,
+				map[string]interface{}{"id": pruned[i].ID, "archived_at": pruned[i].ArchivedAt})
+		}
+		saveQuotes(ctx, db, &post)
+		images := 0
+		if post.ImageURL != nil {
+			images = 1
+		}
+		post.Status = models.NewThreadStatus(0, images, threadLimits(&board, cfg))
+		publishEvent(ctx, db, models.EventPostCreated, post.BoardID, post.ID, &post.ID, newPostView(&post))
+		// Only the poster gets the token, so it is added after the event is published
+		post.DeleteToken = deleteToken
+
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(post)
+		json.NewEncoder(w).Encode(postView(&post, isModerator(getUser(r)), nil))
 	}
 }
 
+// insertThread stores a new thread and its poll, archiving the board's oldest threads first if it
+// is full and its policy allows, and returns the archived threads. The board row is
+// locked for the transaction so concurrent posters cannot push it past max_threads.
+func insertThread(ctx context.Context, db *pgxpool.Pool, post *models.Post, board *models.Board, cfg config.Config, ip string) ([]models.Post, error) {
+	maxThreads := board.IntSetting("max_threads", cfg.DefaultMaxThreads)
+	pruneThreads := board.StringSetting("thread_limit_policy", "prune") == "prune"
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, &postError{http.StatusInternalServerError, "Failed to create thread"}
+	}
+	defer tx.Rollback(ctx)
+
+	if err := models.LockBoard(ctx, tx, board.ID); err != nil {
+		return nil, &postError{http.StatusNotFound, "Board not found"}
+	}
+	threadCount, err := models.CountThreads(ctx, tx, board.ID)
+	if err != nil {
+		return nil, &postError{http.StatusInternalServerError, "Failed to create thread"}
+	}
+	var pruned []models.Post
+	if threadCount >= maxThreads && pruneThreads {
+		pruned, err = models.ArchiveOldestThreads(ctx, tx, board.ID, threadCount-maxThreads+1)
+		if err != nil {
+			return nil, &postError{http.StatusInternalServerError, "Failed to create thread"}
+		}
+	}
+	// Sticky threads are never pruned, so a board full of them still rejects threads
+	if threadCount-len(pruned) >= maxThreads {
+		return nil, &postError{http.StatusForbidden, "Thread limit reached for this board"}
+	}
+
+	if err := models.CreatePost(ctx, tx, post); err != nil {
+		return nil, &postError{http.StatusInternalServerError, "Failed to create thread"}
+	}
+	// A thread's own poster ID depends on its ID, so it is set once the row exists
+	if board.BoolSetting("poster_ids", false) {
+		posterID := tripcode.PosterID(ip, post.ID, post.CreatedAt, cfg.PosterIDSecret, cfg.PosterIDRotation)
+		if err := models.SetPosterID(ctx, tx, post.ID, posterID); err != nil {
+			return nil, &postError{http.StatusInternalServerError, "Failed to create thread"}
+		}
+		post.PosterID = &posterID
+	}
+	if post.Poll != nil {
+		post.Poll.ThreadID = post.ID
+		if err := models.CreatePoll(ctx, tx, post.Poll); err != nil {
+			return nil, &postError{http.StatusInternalServerError, "Failed to create thread"}
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, &postError{http.StatusInternalServerError, "Failed to create thread"}
+	}
+	return pruned, nil
+}
+
+// replyInput is the request body for creating a reply.
+type replyInput struct {
+	Name     string                 `json:"name"`
+	Content  string                 `json:"content"`
+	Sage     bool                   `json:"sage"`
+	Image    string                 `json:"image"`
+	Tags     []string               `json:"tags"`
+	Metadata map[string]interface{} `json:"metadata"`
+	Password string                 `json:"password"`
+	Spoiler  *bool                  `json:"spoiler"`
+	Command  string                 `json:"command"`
+	Capcode  string                 `json:"capcode"`
+}
+
+// postError is a post creation failure carrying the HTTP status to report.
+type postError struct {
+	status  int
+	message string
+}
+
+// Error returns the client-facing message.
+func (e *postError) Error() string {
+	return e.message
+}
+
+// writePostError reports a post creation failure to an HTTP client.
+func writePostError(w http.ResponseWriter, err error) {
+	var pe *postError
+	if errors.As(err, &pe) {
+		http.Error(w, pe.message, pe.status)
+		return
+	}
+	http.Error(w, "Failed to create reply", http.StatusInternalServerError)
+}
+
 // createReply handles POST /threads/{threadID}/replies, creating a reply to a thread.
 func createReply(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		cfg := store.Config()
 		threadID, err := parseInt(chi.URLParam(r, "threadID"))
 		if err != nil {
 			http.Error(w, "Invalid thread ID", http.StatusBadRequest)
 			return
 		}
 
-		var input struct {
-			Content  string                 `json:"content"`
-			Image    string                 `json:"image"`
-			Tags     []string               `json:"tags"`
-			Metadata map[string]interface{} `json:"metadata"`
-		}
+		var input replyInput
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
-		if input.Content == "" || len(input.Content) > cfg.MaxPostLength {
-			http.Error(w, "Content is required and must be within length limits", http.StatusBadRequest)
-			return
-		}
-		if len(input.Tags) > cfg.MaxTags {
-			http.Error(w, fmt.Sprintf("Too many tags, maximum is %d", cfg.MaxTags), http.StatusBadRequest)
+		post, err := submitReply(r.Context(), db, store, threadID, input, getUser(r), middleware.ClientIP(r))
+		if err != nil {
+			writePostError(w, err)
 			return
 		}
 
-		// Get thread to verify it exists and get board_id
-		thread, err := models.GetPost(ctx, db, threadID)
-		if err != nil || thread.ThreadID != nil || thread.ArchivedAt != nil {
-			http.Error(w, "Thread not found or archived", http.StatusNotFound)
-			return
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(postView(post, isModerator(getUser(r)), nil))
+	}
+}
+
+// submitReply validates and stores a reply to a thread, bumps the thread and notifies
+// live subscribers. It is shared by the HTTP and WebSocket APIs; user is the logged-in
+// poster, if any, and ip their client address, used only to derive their poster ID
+// and IP hash.
+func submitReply(ctx context.Context, db *pgxpool.Pool, store storage.Storage, threadID int, input replyInput, user *middleware.User, ip string) (*models.Post, error) {
+	cfg := store.Config()
+
+	if input.Content == "" || len(input.Content) > cfg.MaxPostLength {
+		return nil, &postError{http.StatusBadRequest, "Content is required and must be within length limits"}
+	}
+	if len(input.Tags) > cfg.MaxTags {
+		return nil, &postError{http.StatusBadRequest, fmt.Sprintf("Too many tags, maximum is %d", cfg.MaxTags)}
+	}
+	if len(input.Password) > maxDeletePasswordLength {
+		return nil, &postError{http.StatusBadRequest, fmt.Sprintf("Delete password is too long, maximum is %d bytes", maxDeletePasswordLength)}
+	}
+	capcode, err := verifyCapcode(input.Capcode, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get thread to verify it exists and get board_id
+	thread, err := models.GetPost(ctx, db, threadID)
+	if err != nil || thread.ThreadID != nil || thread.ArchivedAt != nil || thread.Deleted || thread.Expired() {
+		return nil, &postError{http.StatusNotFound, "Thread not found or archived"}
+	}
+	if thread.Locked {
+		return nil, &postError{http.StatusForbidden, "Thread is locked"}
+	}
+
+	// Validate reply and image counts. They are rechecked under lock when the reply is
+	// stored; checking here first avoids uploading images for replies that would fail.
+	var board models.Board
+	err = db.QueryRow(ctx, "SELECT settings FROM boards WHERE id = $1", thread.BoardID).Scan(&board.Settings)
+	if err != nil {
+		return nil, &postError{http.StatusNotFound, "Board not found"}
+	}
+	limits := threadLimits(&board, cfg)
+	status, err := models.GetThreadStatus(ctx, db, threadID, limits)
+	// Cyclical threads take replies past the limit and prune the oldest instead
+	if err != nil || (status.ReplyLimitReached && !thread.Cyclical) {
+		return nil, &postError{http.StatusForbidden, "Reply limit reached for this thread"}
+	}
+
+	var imageURL *string
+	if input.Image != "" {
+		if status.ImageLimitReached {
+			return nil, &postError{http.StatusForbidden, "Image limit reached for this thread"}
+		}
+		imgData, err := base64.StdEncoding.DecodeString(input.Image)
+		if err != nil {
+			return nil, &postError{http.StatusBadRequest, "Invalid image data"}
+		}
+		if maxImageSize, ok := board.Settings["max_image_size"].(float64); ok && len(imgData) > int(maxImageSize) {
+			return nil, &postError{http.StatusBadRequest, "Image size exceeds board limit"}
+		}
+		url, err := store.Upload(ctx, imgData, "jpg")
+		if err != nil {
+			return nil, &postError{http.StatusInternalServerError, "Failed to upload image"}
 		}
+		imageURL = &url
+	}
 
-		// Validate reply count
-		var board models.Board
-		err = db.QueryRow(ctx, "SELECT settings FROM boards WHERE id = $1", thread.BoardID).Scan(&board.Settings)
+	metadata := newMetadata(input.Metadata, input.Tags)
+	if err := runCommand(metadata, input.Command, &board); err != nil {
+		discardUpload(ctx, store, imageURL)
+		return nil, err
+	}
+
+	ipHash := tripcode.IPHash(ip, cfg.IPHashSecret)
+	post := models.Post{
+		BoardID:      thread.BoardID,
+		ThreadID:     &threadID,
+		UserID:       userIDOf(user),
+		Capcode:      capcode,
+		IPHash:       &ipHash,
+		Content:      input.Content,
+		ImageURL:     imageURL,
+		Spoiler:      spoilerImage(imageURL, input.Spoiler, &board),
+		Metadata:     metadata,
+		CreatedAt:    time.Now(),
+		LastBumpedAt: time.Now(),
+		Sage:         input.Sage,
+	}
+
+	setPosterName(&post, input.Name, &board, cfg)
+	if board.BoolSetting("poster_ids", false) {
+		posterID := tripcode.PosterID(ip, threadID, thread.CreatedAt, cfg.PosterIDSecret, cfg.PosterIDRotation)
+		post.PosterID = &posterID
+	}
+	renderContent(ctx, db, &post, &board)
+	deleteToken, err := setDeletePassword(&post, input.Password)
+	if err != nil {
+		discardUpload(ctx, store, imageURL)
+		return nil, &postError{http.StatusInternalServerError, "Failed to create reply"}
+	}
+
+	pruned, deletions, err := insertReply(ctx, db, &post, limits)
+	if err != nil {
+		discardUpload(ctx, store, imageURL)
+		return nil, err
+	}
+	saveQuotes(ctx, db, &post)
+	removePruned(ctx, db, store, pruned, deletions)
+	publishEvent(ctx, db, models.EventPostCreated, post.BoardID, threadID, &post.ID, newPostView(&post))
+	post.DeleteToken = deleteToken
+
+	return &post, nil
+}
+
+// deletePostPassword handles DELETE /posts/{postID}, letting anonymous posters delete
+// their own posts with the delete password or token they got when posting.
+// @Summary Delete post with password
+// @Description Soft-delete a post using the delete password given when it was created, or the delete_token returned if none was. Only allowed within the board's delete_window (seconds) after posting.
+// @Tags posts
+// @Accept json
+// @Param postID path int true "Post ID"
+// @Param credentials body object{password=string} true "Delete password or token"
+// @Success 204 {string} string "Post deleted"
+// @Failure 400 {string} string "Invalid post ID or request body"
+// @Failure 403 {string} string "Incorrect password or past the delete window"
+// @Failure 404 {string} string "Post not found"
+// @Failure 500 {string} string "Failed to delete post"
+// @Router /posts/{postID} [delete]
+func deletePostPassword(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		postID, err := parseInt(chi.URLParam(r, "postID"))
 		if err != nil {
-			http.Error(w, "Board not found", http.StatusNotFound)
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
 			return
 		}
-		maxReplies := cfg.DefaultMaxReplies
-		if val, ok := board.Settings["max_replies"]; ok {
-			if mr, ok := val.(float64); ok {
-				maxReplies = int(mr)
-			}
+
+		var input struct {
+			Password string `json:"password"`
 		}
-		var replyCount int
-		err = db.QueryRow(ctx, "SELECT COUNT(*) FROM posts WHERE thread_id = $1 AND archived_at IS NULL", threadID).Scan(&replyCount)
-		if err != nil || replyCount >= maxReplies {
-			http.Error(w, "Reply limit reached for this thread", http.StatusForbidden)
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Password == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
-		var imageURL *string
-		if input.Image != "" {
-			imgData, err := base64.StdEncoding.DecodeString(input.Image)
-			if err != nil {
-				http.Error(w, "Invalid image data", http.StatusBadRequest)
-				return
-			}
-			if maxImageSize, ok := board.Settings["max_image_size"].(float64); ok && len(imgData) > int(maxImageSize) {
-				http.Error(w, "Image size exceeds board limit", http.StatusBadRequest)
-				return
-			}
-			url, err := store.Upload(ctx, imgData, "jpg")
-			if err != nil {
-				http.Error(w, "Failed to upload image", http.StatusInternalServerError)
-				return
-			}
-			imageURL = &url
+		post, err := models.GetPost(ctx, db, postID)
+		if err != nil || post.Deleted {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
 		}
-
-		userID := getUserID(r)
-		if input.Metadata == nil {
-			input.Metadata = make(map[string]interface{})
+		hash, err := models.GetDeletePassword(ctx, db, postID)
+		if err != nil {
+			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+			return
 		}
-		if len(input.Tags) > 0 {
-			input.Metadata["tags"] = input.Tags
+		if hash == nil || !checkDeletePassword(*hash, input.Password) {
+			http.Error(w, "Incorrect password", http.StatusForbidden)
+			return
 		}
-
-		post := models.Post{
-			BoardID:      thread.BoardID,
-			ThreadID:     &threadID,
-			UserID:       userID,
-			Content:      input.Content,
-			ImageURL:     imageURL,
-			Metadata:     input.Metadata,
-			CreatedAt:    time.Now(),
-			LastBumpedAt: time.Now(),
+		board, err := models.GetBoard(ctx, db, post.BoardID)
+		if err != nil {
+			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+			return
 		}
-
-		if err := models.CreatePost(ctx, db, &post); err != nil {
-			http.Error(w, "Failed to create reply", http.StatusInternalServerError)
+		window := time.Duration(board.IntSetting("delete_window", int(cfg.DefaultDeleteWindow/time.Second))) * time.Second
+		if time.Since(post.CreatedAt) > window {
+			http.Error(w, "Delete window has passed", http.StatusForbidden)
 			return
 		}
 
-		// Bump thread
-		if err := models.UpdateThreadBumpTime(ctx, db, threadID, time.Now()); err != nil {
-			http.Error(w, "Failed to bump thread", http.StatusInternalServerError)
+		post, err = models.SoftDeletePost(ctx, db, postID, nil, nil)
+		if err != nil {
+			if err.Error() == "post not found" {
+				http.Error(w, "Post not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
 			return
 		}
+		publishPostDeleted(ctx, db, post)
 
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(post)
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
 // deletePostUser handles DELETE /posts/{postID}/user, allowing users to delete their own posts.
+// The post is soft-deleted and shown as a tombstone until it is purged.
 func deletePostUser(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -261,22 +529,147 @@ func deletePostUser(db *pgxpool.Pool) http.HandlerFunc {
 		}
 
 		post, err := models.GetPost(ctx, db, postID)
-		if err != nil || post.UserID == nil || *post.UserID != user.ID {
+		if err != nil || post.Deleted || post.UserID == nil || *post.UserID != user.ID {
 			http.Error(w, "Post not found or not owned by user", http.StatusForbidden)
 			return
 		}
 
-		if err := models.DeletePost(ctx, db, postID); err != nil {
+		post, err = models.SoftDeletePost(ctx, db, postID, &user.ID, nil)
+		if err != nil {
+			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+			return
+		}
+		publishPostDeleted(ctx, db, post)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deletePostAdmin handles DELETE /posts/{postID}/admin?reason={reason}, allowing moderators to
+// delete any post. The post is soft-deleted with the moderator and reason recorded.
+// @Summary Delete post (moderator)
+// @Description Soft-delete any post, which is shown as a tombstone in thread views until purged. Deleting a thread's opening post hides the thread.
+// @Tags posts
+// @Security BearerAuth
+// @Param postID path int true "Post ID"
+// @Param reason query string false "Reason for deletion"
+// @Success 204 {string} string "Post deleted"
+// @Failure 400 {string} string "Invalid post ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Moderator access required"
+// @Failure 404 {string} string "Post not found"
+// @Failure 500 {string} string "Failed to delete post"
+// @Router /posts/{postID}/admin [delete]
+func deletePostAdmin(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		postID, err := parseInt(chi.URLParam(r, "postID"))
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		var reason *string
+		if val := r.URL.Query().Get("reason"); val != "" {
+			reason = &val
+		}
+		post, err := models.SoftDeletePost(ctx, db, postID, getUserID(r), reason)
+		if err != nil {
+			if err.Error() == "post not found" {
+				http.Error(w, "Post not found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
 			return
 		}
+		publishPostDeleted(ctx, db, post)
 
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-// deletePostAdmin handles DELETE /posts/{postID}/admin, allowing admins to delete any post.
-func deletePostAdmin(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+// deletePostFile handles DELETE /posts/{postID}/file, allowing moderators to remove a post's
+// image while keeping its text.
+// @Summary Delete post file (moderator)
+// @Description Remove a post's image from storage, leaving the post and its text in place
+// @Tags posts
+// @Produce json
+// @Security BearerAuth
+// @Param postID path int true "Post ID"
+// @Success 200 {object} ModPostView "Post without its image"
+// @Failure 400 {string} string "Invalid post ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Moderator access required"
+// @Failure 404 {string} string "Post not found or has no image"
+// @Failure 500 {string} string "Failed to delete image"
+// @Router /posts/{postID}/file [delete]
+func deletePostFile(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		postID, err := parseInt(chi.URLParam(r, "postID"))
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "Failed to delete image", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		original, err := models.LockPost(ctx, tx, postID)
+		if err != nil || original.ImageURL == nil {
+			http.Error(w, "Post not found or has no image", http.StatusNotFound)
+			return
+		}
+		post, err := models.DeletePostFile(ctx, tx, postID)
+		if err != nil {
+			http.Error(w, "Failed to delete image", http.StatusInternalServerError)
+			return
+		}
+		// Queue the file with the update so a storage failure leaves it queued for retry
+		deletions, err := models.QueueFileDeletions(ctx, tx, []string{*original.ImageURL})
+		if err != nil {
+			http.Error(w, "Failed to delete image", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "Failed to delete image", http.StatusInternalServerError)
+			return
+		}
+		purge.Files(ctx, db, store, deletions)
+
+		threadID := post.ID
+		if post.ThreadID != nil {
+			threadID = *post.ThreadID
+		}
+		publishEvent(ctx, db, models.EventPostUpdated, post.BoardID, threadID, &post.ID, newPostView(post))
+
+		flagCounts, err := modFlagCounts(r, db, post)
+		if err != nil {
+			log.Error().Err(err).Int("post_id", postID).Msg("Failed to count flags")
+		}
+		json.NewEncoder(w).Encode(postView(post, isModerator(getUser(r)), flagCounts))
+	}
+}
+
+// purgePost handles DELETE /posts/{postID}/purge, allowing admins to permanently delete
+// a post, or a thread with all of its replies, and their images.
+// @Summary Purge post (admin)
+// @Description Permanently delete a post, or a thread with all of its replies, along with their flags, quotes, revisions and images. Unlike regular deletion, this leaves no tombstone.
+// @Tags posts
+// @Security BearerAuth
+// @Param postID path int true "Post ID"
+// @Success 204 {string} string "Post purged"
+// @Failure 400 {string} string "Invalid post ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Admin access required"
+// @Failure 404 {string} string "Post not found"
+// @Failure 500 {string} string "Failed to purge post"
+// @Router /posts/{postID}/purge [delete]
+func purgePost(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		postID, err := parseInt(chi.URLParam(r, "postID"))
@@ -290,27 +683,315 @@ func deletePostAdmin(db *pgxpool.Pool, store storage.Storage) http.HandlerFunc {
 			http.Error(w, "Post not found", http.StatusNotFound)
 			return
 		}
+		if err := purge.Post(ctx, db, store, postID); err != nil {
+			http.Error(w, "Failed to purge post", http.StatusInternalServerError)
+			return
+		}
+		if !post.Deleted {
+			publishPostDeleted(ctx, db, post)
+		}
 
-		if post.ImageURL != nil {
-			if err := store.Delete(ctx, *post.ImageURL); err != nil {
-				http.Error(w, "Failed to delete image", http.StatusInternalServerError)
-				return
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// insertReply stores a reply, bumps its thread unless the reply is saged or the thread
+// is past its bump limit, and prunes cyclical threads, returning the pruned replies and
+// their queued file deletions. The thread row is locked for the transaction so concurrent replies cannot exceed its
+// limits or bump it after it has been archived or locked.
+func insertReply(ctx context.Context, db *pgxpool.Pool, post *models.Post, limits models.ThreadLimits) ([]models.Post, []models.FileDeletion, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, nil, &postError{http.StatusInternalServerError, "Failed to create reply"}
+	}
+	defer tx.Rollback(ctx)
+
+	if err := models.LockBoard(ctx, tx, post.BoardID); err != nil {
+		return nil, nil, &postError{http.StatusNotFound, "Board not found"}
+	}
+	thread, err := models.LockThread(ctx, tx, *post.ThreadID)
+	if err != nil || thread.Expired() {
+		return nil, nil, &postError{http.StatusNotFound, "Thread not found or archived"}
+	}
+	if thread.Locked {
+		return nil, nil, &postError{http.StatusForbidden, "Thread is locked"}
+	}
+	status, err := models.GetThreadStatus(ctx, tx, thread.ID, limits)
+	if err != nil {
+		return nil, nil, &postError{http.StatusInternalServerError, "Failed to create reply"}
+	}
+	// Cyclical threads take replies past the limit and prune the oldest instead
+	if status.ReplyLimitReached && !thread.Cyclical {
+		return nil, nil, &postError{http.StatusForbidden, "Reply limit reached for this thread"}
+	}
+	if post.ImageURL != nil && status.ImageLimitReached {
+		return nil, nil, &postError{http.StatusForbidden, "Image limit reached for this thread"}
+	}
+
+	if err := models.CreatePost(ctx, tx, post); err != nil {
+		return nil, nil, &postError{http.StatusInternalServerError, "Failed to create reply"}
+	}
+	if !post.Sage && !status.BumpLimitReached {
+		if err := models.UpdateThreadBumpTime(ctx, tx, thread.ID, post.CreatedAt); err != nil {
+			return nil, nil, &postError{http.StatusInternalServerError, "Failed to bump thread"}
+		}
+	}
+	var pruned []models.Post
+	var deletions []models.FileDeletion
+	if thread.Cyclical {
+		if pruned, err = models.PruneReplies(ctx, tx, thread.ID, limits.Replies); err != nil {
+			return nil, nil, &postError{http.StatusInternalServerError, "Failed to create reply"}
+		}
+		// Queue the pruned images with the prune so a storage failure cannot orphan them
+		var urls []string
+		for _, p := range pruned {
+			if p.ImageURL != nil {
+				urls = append(urls, *p.ImageURL)
 			}
 		}
+		if deletions, err = models.QueueFileDeletions(ctx, tx, urls); err != nil {
+			return nil, nil, &postError{http.StatusInternalServerError, "Failed to create reply"}
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, &postError{http.StatusInternalServerError, "Failed to create reply"}
+	}
+	return pruned, deletions, nil
+}
 
-		if err := models.DeletePost(ctx, db, postID); err != nil {
-			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
-			return
+// setDeletePassword stores the bcrypt hash of a post's delete password. Without one, a
+// random token is generated in its place and returned so the poster can be given it.
+// Tokens are random enough that a plain SHA-256 hash protects them, which spares every
+// post without a password the cost of bcrypt.
+func setDeletePassword(post *models.Post, password string) (string, error) {
+	if password == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		token := base64.RawURLEncoding.EncodeToString(buf)
+		hashed := tokenHashPrefix + hashToken(token)
+		post.DeletePassword = &hashed
+		return token, nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	hashed := string(hash)
+	post.DeletePassword = &hashed
+	return "", nil
+}
+
+// checkDeletePassword reports whether password matches a stored delete password hash,
+// which is either a generated token's SHA-256 hash or a chosen password's bcrypt hash.
+func checkDeletePassword(hash, password string) bool {
+	if digest, ok := strings.CutPrefix(hash, tokenHashPrefix); ok {
+		return subtle.ConstantTimeCompare([]byte(digest), []byte(hashToken(password))) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// hashToken returns the hex SHA-256 hash of a generated delete token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// discardUpload deletes an image uploaded for a post that could not be stored. It runs
+// even if the request was cancelled, since that may be why the post failed.
+func discardUpload(ctx context.Context, store storage.Storage, imageURL *string) {
+	if imageURL == nil {
+		return
+	}
+	if err := store.Delete(context.WithoutCancel(ctx), *imageURL); err != nil {
+		log.Error().Err(err).Str("image_url", *imageURL).Msg("Failed to delete orphaned image")
+	}
+}
+
+// removePruned deletes the queued images of replies pruned from a cyclical thread and
+// announces their deletion. Images that cannot be deleted stay queued for retry.
+func removePruned(ctx context.Context, db *pgxpool.Pool, store storage.Storage, pruned []models.Post, deletions []models.FileDeletion) {
+	purge.Files(ctx, db, store, deletions)
+	for i := range pruned {
+		publishPostDeleted(ctx, db, &pruned[i])
+	}
+}
+
+// threadLimits reads a board's per-thread reply, bump and image limits, falling back
+// to the configured defaults.
+func threadLimits(board *models.Board, cfg config.Config) models.ThreadLimits {
+	return models.ThreadLimits{
+		Replies: board.IntSetting("max_replies", cfg.DefaultMaxReplies),
+		Bump:    board.IntSetting("bump_limit", cfg.DefaultBumpLimit),
+		Images:  board.IntSetting("image_limit", cfg.DefaultImageLimit),
+	}
+}
+
+// setPosterName sets the display name and tripcode from the name field, which may
+// carry a #password. Boards with forced_anon set ignore it entirely.
+func setPosterName(post *models.Post, input string, board *models.Board, cfg config.Config) {
+	if board.BoolSetting("forced_anon", false) {
+		return
+	}
+	name, trip := tripcode.Parse(input, cfg.TripcodeSecret)
+	if name != "" {
+		post.Name = &name
+	}
+	if trip != "" {
+		post.Tripcode = &trip
+	}
+}
+
+// reservedMetadata lists the metadata keys only the server sets. Clients cannot supply
+// them, so command results and capcodes cannot be forged.
+var reservedMetadata = []string{"command", "capcode"}
+
+// newMetadata prepares a new post's metadata from the client's, adding its tags and
+// dropping reserved keys.
+func newMetadata(metadata map[string]interface{}, tags []string) map[string]interface{} {
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	for _, key := range reservedMetadata {
+		delete(metadata, key)
+	}
+	if len(tags) > 0 {
+		metadata["tags"] = tags
+	}
+	return metadata
+}
+
+// verifyCapcode checks a requested capcode against the poster's JWT role: staff may
+// post with the capcode of their own role or any lower staff role.
+func verifyCapcode(capcode string, user *middleware.User) (*string, error) {
+	if capcode == "" {
+		return nil, nil
+	}
+	if capcode == models.RoleUser || !models.ValidRole(capcode) {
+		return nil, &postError{http.StatusBadRequest, "Capcode must be janitor, mod or admin"}
+	}
+	if user == nil || !models.RoleAtLeast(user.EffectiveRole(), capcode) {
+		return nil, &postError{http.StatusForbidden, "Not allowed to post with this capcode"}
+	}
+	return &capcode, nil
+}
+
+// runCommand evaluates a new post's command, such as a dice roll, and stores the
+// result under metadata["command"]. Boards can turn commands off with the commands
+// setting.
+func runCommand(metadata map[string]interface{}, command string, board *models.Board) error {
+	if command == "" {
+		return nil
+	}
+	if !board.BoolSetting("commands", true) {
+		return &postError{http.StatusBadRequest, "Commands are disabled on this board"}
+	}
+	result, err := commands.Run(command)
+	if err != nil {
+		return &postError{http.StatusBadRequest, err.Error()}
+	}
+	metadata["command"] = result
+	return nil
+}
+
+// threadExpiry works out when a new thread expires: thread_lifetime seconds after it
+// is created on boards that set one, or after expiresIn seconds if the poster asked for
+// less. Threads on other boards without a requested expiry never expire.
+func threadExpiry(board *models.Board, expiresIn int, created time.Time) *time.Time {
+	lifetime := board.IntSetting("thread_lifetime", 0)
+	if expiresIn > 0 && (lifetime <= 0 || expiresIn < lifetime) {
+		lifetime = expiresIn
+	}
+	if lifetime <= 0 {
+		return nil
+	}
+	expiresAt := created.Add(time.Duration(lifetime) * time.Second)
+	return &expiresAt
+}
+
+// spoilerImage decides whether a new post's image is spoilered: as the poster asked,
+// or by the board's spoiler_by_default setting if they did not say.
+func spoilerImage(imageURL *string, requested *bool, board *models.Board) bool {
+	if imageURL == nil {
+		return false
+	}
+	if requested != nil {
+		return *requested
+	}
+	return board.BoolSetting("spoiler_by_default", false)
+}
+
+// renderContent resolves a new post's >>quotes and renders its content to HTML with
+// the markup enabled on its board. A failed lookup only turns quotes into dead links,
+// so it is logged rather than rejecting the post.
+func renderContent(ctx context.Context, db *pgxpool.Pool, post *models.Post, board *models.Board) {
+	if err := models.ResolveQuotes(ctx, db, post, markup.ParseReferences(post.Content)); err != nil {
+		log.Error().Err(err).Msg("Failed to resolve quotes")
+	}
+	post.ContentHTML = markup.Render(post.Content, markupOptions(board), quoteResolver(post))
+}
+
+// markupOptions reads the per-board markup toggles, all enabled by default.
+func markupOptions(board *models.Board) markup.Options {
+	return markup.Options{
+		Greentext: board.BoolSetting("markup_greentext", true),
+		Quotes:    board.BoolSetting("markup_quotes", true),
+		Spoilers:  board.BoolSetting("markup_spoilers", true),
+		Code:      board.BoolSetting("markup_code", true),
+		Autolink:  board.BoolSetting("markup_autolink", true),
+	}
+}
+
+// quoteResolver links quote references to the posts resolved for a new post, by board
+// post number.
+func quoteResolver(post *models.Post) markup.QuoteResolver {
+	return func(ref markup.Reference) (string, bool) {
+		q, ok := post.QuoteTarget(ref)
+		if !ok {
+			return "", false
+		}
+		if q.CrossThread {
+			return fmt.Sprintf("/boards/%s/threads/%d#p%d", q.Board, q.ThreadNumber, q.Number), true
 		}
+		return fmt.Sprintf("#p%d", q.Number), true
+	}
+}
 
-		w.WriteHeader(http.StatusNoContent)
+// saveQuotes records a new post's resolved quotes. A failure only costs the backlinks,
+// so it is logged rather than failing a post that has already been stored.
+func saveQuotes(ctx context.Context, db *pgxpool.Pool, post *models.Post) {
+	if err := models.SaveQuotes(ctx, db, post); err != nil {
+		log.Error().Err(err).Int("post_id", post.ID).Msg("Failed to save quotes")
 	}
 }
 
+// publishPostDeleted announces a post deletion to subscribers of its board and thread.
+func publishPostDeleted(ctx context.Context, db *pgxpool.Pool, post *models.Post) {
+	threadID := post.ID
+	if post.ThreadID != nil {
+		threadID = *post.ThreadID
+	}
+	publishEvent(ctx, db, models.EventPostDeleted, post.BoardID, threadID, &post.ID, map[string]interface{}{"id": post.ID})
+}
+
 // getUserID extracts user ID from JWT context, if present.
 func getUserID(r *http.Request) *int {
+	return userIDOf(getUser(r))
+}
+
+// getUser extracts the JWT user from context, if present.
+func getUser(r *http.Request) *middleware.User {
 	if user, ok := r.Context().Value(middleware.UserContextKey).(*middleware.User); ok && user.ID != 0 {
-		return &user.ID
+		return user
 	}
 	return nil
 }
+
+// userIDOf returns a user's ID, or nil for anonymous posters.
+func userIDOf(user *middleware.User) *int {
+	if user == nil {
+		return nil
+	}
+	return &user.ID
+}
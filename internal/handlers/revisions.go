@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/middleware"
+	"github.com/cobalto/noppera/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// editPost handles PUT /posts/{postID}, letting a registered user edit their own post
+// within the board's edit window, or a moderator edit any post.
+// @Summary Edit post
+// @Description Replace a post's content (and a thread's title), keeping the previous version as a revision. Owners may edit within the board's edit_window (seconds); moderators may edit at any time. Posts in archived, deleted, expired or locked threads cannot be edited.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param postID path int true "Post ID"
+// @Param post body object{title=string,content=string} true "New title and content"
+// @Success 200 {object} PostView "Edited post (ModPostView for moderators)"
+// @Failure 400 {string} string "Invalid post ID or request body"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Post not owned by user, thread locked, or past the edit window"
+// @Failure 404 {string} string "Post or thread not found, archived or expired"
+// @Failure 500 {string} string "Failed to edit post"
+// @Router /posts/{postID} [put]
+func editPost(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		postID, err := parseInt(chi.URLParam(r, "postID"))
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := r.Context().Value(middleware.UserContextKey).(*middleware.User)
+		if !ok || user.ID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var input struct {
+			Title   *string `json:"title"`
+			Content string  `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if input.Content == "" || len(input.Content) > cfg.MaxPostLength {
+			http.Error(w, "Content is required and must be within length limits", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			http.Error(w, "Failed to edit post", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(ctx)
+
+		// Lock the thread before the post, in the same order as replies and pruning, and
+		// refuse edits once the thread no longer takes replies
+		current, err := models.GetPost(ctx, db, postID)
+		if err != nil || current.Deleted {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		threadID := current.ID
+		if current.ThreadID != nil {
+			threadID = *current.ThreadID
+		}
+		thread, err := models.LockThread(ctx, tx, threadID)
+		if err != nil || thread.Expired() {
+			http.Error(w, "Thread not found or archived", http.StatusNotFound)
+			return
+		}
+		if thread.Locked {
+			http.Error(w, "Thread is locked", http.StatusForbidden)
+			return
+		}
+		old, err := models.LockPost(ctx, tx, postID)
+		if err != nil || old.Deleted {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		board, err := models.GetBoard(ctx, db, old.BoardID)
+		if err != nil {
+			http.Error(w, "Failed to edit post", http.StatusInternalServerError)
+			return
+		}
+		if !isModerator(user) {
+			if old.UserID == nil || *old.UserID != user.ID {
+				http.Error(w, "Post not owned by user", http.StatusForbidden)
+				return
+			}
+			window := time.Duration(board.IntSetting("edit_window", int(cfg.DefaultEditWindow/time.Second))) * time.Second
+			if time.Since(old.CreatedAt) > window {
+				http.Error(w, "Edit window has passed", http.StatusForbidden)
+				return
+			}
+		}
+		post := *old
+		post.Content = input.Content
+		// Only threads have titles; replies keep theirs unset
+		if input.Title != nil && post.ThreadID == nil {
+			post.Title = input.Title
+		}
+		post.Quotes = nil
+		renderContent(ctx, db, &post, board)
+
+		editorID := user.ID
+		if err := models.EditPost(ctx, tx, old, &post, &editorID); err != nil {
+			http.Error(w, "Failed to edit post", http.StatusInternalServerError)
+			return
+		}
+		if err := models.ReplaceQuotes(ctx, tx, &post); err != nil {
+			http.Error(w, "Failed to edit post", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			http.Error(w, "Failed to edit post", http.StatusInternalServerError)
+			return
+		}
+
+		publishEvent(ctx, db, models.EventPostUpdated, post.BoardID, threadID, &post.ID, newPostView(&post))
+
+		flagCounts, err := modFlagCounts(r, db, &post)
+		if err != nil {
+			log.Error().Err(err).Int("post_id", post.ID).Msg("Failed to count flags")
+		}
+		json.NewEncoder(w).Encode(postView(&post, isModerator(user), flagCounts))
+	}
+}
+
+// listRevisions handles GET /posts/{postID}/revisions, listing a post's previous versions.
+// @Summary List post revisions
+// @Description Get the previous versions of an edited post, oldest first (moderators only)
+// @Tags posts
+// @Produce json
+// @Security BearerAuth
+// @Param postID path int true "Post ID"
+// @Success 200 {array} models.Revision "Revisions"
+// @Failure 400 {string} string "Invalid post ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Moderator access required"
+// @Failure 404 {string} string "Post not found"
+// @Failure 500 {string} string "Failed to list revisions"
+// @Router /posts/{postID}/revisions [get]
+func listRevisions(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		postID, err := parseInt(chi.URLParam(r, "postID"))
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := models.GetPost(ctx, db, postID); err != nil {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		revisions, err := models.ListRevisions(ctx, db, postID)
+		if err != nil {
+			http.Error(w, "Failed to list revisions", http.StatusInternalServerError)
+			return
+		}
+		if revisions == nil {
+			revisions = []models.Revision{}
+		}
+		json.NewEncoder(w).Encode(revisions)
+	}
+}
@@ -1,22 +1,26 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/middleware"
 	"github.com/cobalto/noppera/internal/models"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
 )
 
 // RegisterSearch sets up search-related routes.
-func RegisterSearch(r chi.Router, db *pgxpool.Pool) {
-	r.Get("/posts/search", searchPosts(db))
+func RegisterSearch(r chi.Router, db *pgxpool.Pool, cfg config.Config) {
+	r.With(middleware.OptionalAuth(cfg)).Get("/posts/search", searchPosts(db, cfg))
 }
 
-// searchPosts handles GET /posts/search?query={term}&tag={tag}&board_id={id}, searching posts by content or tags.
+// searchPosts handles GET /posts/search?query={term}&tag={tag}&board_id={id}&cursor={cursor}&limit={n}, searching posts by content or tags.
 // @Summary Search posts
 // @Description Search posts by content, tags, or board
 // @Tags search
@@ -24,13 +28,23 @@ func RegisterSearch(r chi.Router, db *pgxpool.Pool) {
 // @Param query query string false "Search query"
 // @Param tag query string false "Tag to filter by"
 // @Param board_id query int false "Board ID to filter by"
-// @Success 200 {array} models.Post "Search results"
-// @Failure 400 {string} string "Invalid board ID"
+// @Param cursor query string false "Cursor from a previous page's next_cursor"
+// @Param limit query int false "Page size"
+// @Param If-None-Match header string false "ETag of a cached response"
+// @Param If-Modified-Since header string false "Last-Modified of a cached response"
+// @Success 200 {object} PageResponse[PostView] "Page of search results (ModPostView items for moderators)"
+// @Success 304 {string} string "Not modified"
+// @Failure 400 {string} string "Invalid board ID, cursor or limit"
 // @Failure 500 {string} string "Failed to search posts"
 // @Router /posts/search [get]
-func searchPosts(db *pgxpool.Pool) http.HandlerFunc {
+func searchPosts(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
+		after, limit, err := parsePage(r, cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		query := r.URL.Query().Get("query")
 		tag := r.URL.Query().Get("tag")
 		boardIDStr := r.URL.Query().Get("board_id")
@@ -45,48 +59,143 @@ func searchPosts(db *pgxpool.Pool) http.HandlerFunc {
 			boardID = &id
 		}
 
-		// Build SQL query with full-text search
-		sql := "SELECT id, board_id, thread_id, user_id, title, content, image_url, metadata, created_at, updated_at, last_bumped_at, archived_at " +
-			"FROM posts WHERE archived_at IS NULL"
+		// Build SQL filter with full-text search. Replies share their thread's visibility,
+		// so also skip replies in deleted, archived or expired threads
+		where := "archived_at IS NULL AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > now()) " +
+			"AND NOT EXISTS (SELECT 1 FROM posts t WHERE t.id = posts.thread_id " +
+			"AND (t.deleted_at IS NOT NULL OR t.archived_at IS NOT NULL OR t.expires_at <= now()))"
 		args := []interface{}{}
-		var conditions []string
 
 		if query != "" {
-			conditions = append(conditions, "to_tsvector('english', content) @@ to_tsquery('english', $1)")
 			args = append(args, strings.ReplaceAll(query, " ", " & "))
+			where += fmt.Sprintf(" AND to_tsvector('english', content) @@ to_tsquery('english', $%d)", len(args))
 		}
 		if tag != "" {
-			conditions = append(conditions, "metadata->'tags' @> $2")
 			args = append(args, fmt.Sprintf(`["%s"]`, tag))
+			where += fmt.Sprintf(" AND metadata->'tags' @> $%d", len(args))
 		}
 		if boardID != nil {
-			conditions = append(conditions, "board_id = $3")
 			args = append(args, *boardID)
+			where += fmt.Sprintf(" AND board_id = $%d", len(args))
 		}
+		if after != nil {
+			args = append(args, after.Time, after.ID)
+			where += fmt.Sprintf(" AND (last_bumped_at, id) < ($%d, $%d)", len(args)-1, len(args))
+		}
+		// Fetch one extra row to learn whether another page follows
+		order := fmt.Sprintf(" ORDER BY last_bumped_at DESC, id DESC LIMIT %d", limit+1)
 
-		if len(conditions) > 0 {
-			sql += " AND " + strings.Join(conditions, " AND ")
+		// Validate the client's cached copy from a summary of the matching rows before
+		// fetching full posts
+		var matchCount int
+		var lastModified time.Time
+		var digest string
+		err = db.QueryRow(ctx,
+			"SELECT COUNT(*), COALESCE(MAX(changed), to_timestamp(0)), COALESCE(md5(string_agg(id || '@' || changed, ',')), '') FROM ("+
+				"SELECT id, GREATEST(last_bumped_at, COALESCE(updated_at, created_at)) AS changed FROM posts WHERE "+where+order+") matches",
+			args...,
+		).Scan(&matchCount, &lastModified, &digest)
+		if err != nil {
+			http.Error(w, "Failed to search posts", http.StatusInternalServerError)
+			return
+		}
+		mod := isModerator(getUser(r))
+		// Moderators also see flag counts, which change without touching any post
+		flagVersion := ""
+		if mod {
+			var flags int
+			var latestFlag time.Time
+			err = db.QueryRow(ctx,
+				"SELECT COUNT(*), COALESCE(MAX(f.created_at), to_timestamp(0)) FROM flags f JOIN (SELECT id FROM posts WHERE "+where+order+") matches "+
+					"ON matches.id = f.post_id",
+				args...,
+			).Scan(&flags, &latestFlag)
+			if err != nil {
+				http.Error(w, "Failed to search posts", http.StatusInternalServerError)
+				return
+			}
+			flagVersion = fmt.Sprintf("%d:%d", flags, latestFlag.UnixNano())
+			if latestFlag.After(lastModified) {
+				lastModified = latestFlag
+			}
+		}
+		setViewerCaching(w, mod)
+		if notModified(w, r, makeETag("search", r.URL.RawQuery, matchCount, digest, mod, flagVersion), lastModified) {
+			return
+		}
+
+		var flagCounts map[int]int
+		if mod {
+			flagCounts = make(map[int]int)
+			rows, err := db.Query(ctx,
+				"SELECT f.post_id, COUNT(*) FROM flags f JOIN (SELECT id FROM posts WHERE "+where+order+") matches "+
+					"ON matches.id = f.post_id GROUP BY f.post_id",
+				args...,
+			)
+			if err != nil {
+				http.Error(w, "Failed to search posts", http.StatusInternalServerError)
+				return
+			}
+			for rows.Next() {
+				var postID, count int
+				if err := rows.Scan(&postID, &count); err != nil {
+					rows.Close()
+					http.Error(w, "Failed to search posts", http.StatusInternalServerError)
+					return
+				}
+				flagCounts[postID] = count
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				http.Error(w, "Failed to search posts", http.StatusInternalServerError)
+				return
+			}
 		}
-		sql += " ORDER BY last_bumped_at DESC LIMIT 100"
 
-		rows, err := db.Query(ctx, sql, args...)
+		rows, err := db.Query(ctx,
+			"SELECT "+models.PostColumns+" FROM posts WHERE "+where+order,
+			args...,
+		)
 		if err != nil {
 			http.Error(w, "Failed to search posts", http.StatusInternalServerError)
 			return
 		}
 		defer rows.Close()
 
-		var posts []models.Post
+		// Stream results as they are scanned
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := io.WriteString(w, `{"items":`); err != nil {
+			return
+		}
+		posts, err := newJSONArrayWriter(w)
+		if err != nil {
+			return
+		}
+		var last, next *models.Cursor
 		for rows.Next() {
+			if posts.count == limit {
+				// The extra row only signals that the page ends at the last one written
+				next = last
+				break
+			}
 			var p models.Post
-			if err := rows.Scan(&p.ID, &p.BoardID, &p.ThreadID, &p.UserID, &p.Title, &p.Content, &p.ImageURL, &p.Metadata,
-				&p.CreatedAt, &p.UpdatedAt, &p.LastBumpedAt, &p.ArchivedAt); err != nil {
-				http.Error(w, "Failed to scan posts", http.StatusInternalServerError)
+			if err := models.ScanPost(rows, &p); err != nil {
+				log.Error().Err(err).Msg("Failed to scan posts")
+				return
+			}
+			if err := posts.Write(postView(&p, mod, flagCounts)); err != nil {
 				return
 			}
-			posts = append(posts, p)
+			last = &models.Cursor{Time: p.LastBumpedAt, ID: p.ID}
 		}
-
-		json.NewEncoder(w).Encode(posts)
+		if err := rows.Err(); err != nil {
+			log.Error().Err(err).Msg("Failed to search posts")
+			return
+		}
+		posts.Close()
+		if next != nil {
+			fmt.Fprintf(w, `,"next_cursor":%q`, encodeCursor(next))
+		}
+		io.WriteString(w, "}")
 	}
 }
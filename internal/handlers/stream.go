@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonArrayWriter streams a JSON array one element at a time so that large result
+// sets are encoded straight from database rows instead of being held in memory.
+type jsonArrayWriter struct {
+	w     io.Writer
+	enc   *json.Encoder
+	count int
+}
+
+// newJSONArrayWriter opens a JSON array on w.
+func newJSONArrayWriter(w io.Writer) (*jsonArrayWriter, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+	return &jsonArrayWriter{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// Write appends an element to the array.
+func (a *jsonArrayWriter) Write(v interface{}) error {
+	if a.count > 0 {
+		if _, err := io.WriteString(a.w, ","); err != nil {
+			return err
+		}
+	}
+	a.count++
+	return a.enc.Encode(v)
+}
+
+// Close terminates the array.
+func (a *jsonArrayWriter) Close() error {
+	_, err := io.WriteString(a.w, "]")
+	return err
+}
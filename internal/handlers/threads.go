@@ -2,26 +2,148 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 
+	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/middleware"
 	"github.com/cobalto/noppera/internal/models"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
 )
 
 // RegisterThreads sets up thread-related routes.
-func RegisterThreads(r chi.Router, db *pgxpool.Pool) {
-	r.Get("/threads/{threadID}", getThread(db))
+func RegisterThreads(r chi.Router, db *pgxpool.Pool, cfg config.Config) {
+	r.With(middleware.OptionalAuth(cfg)).Get("/boards/{boardSlug}/threads", listThreads(db, cfg))
+	r.With(middleware.OptionalAuth(cfg)).Get("/threads/{threadID}", getThread(db, cfg))
+	r.With(middleware.OptionalAuth(cfg)).Get("/boards/{boardSlug}/threads/{threadNumber}", getThreadByNumber(db, cfg))
+	r.With(middleware.Auth(cfg), middleware.ModOnly).Put("/threads/{threadID}/state", setThreadState(db))
 }
 
-// ThreadResponse represents a thread with its replies.
+// ThreadResponse represents a thread with its replies. getThread streams this shape
+// rather than building it in memory, with ModPostView entries for moderators.
 type ThreadResponse struct {
-	Thread  models.Post   `json:"thread"`
-	Replies []models.Post `json:"replies"`
+	Thread  PostView   `json:"thread"`
+	Replies []PostView `json:"replies"`
+}
+
+// listThreads handles GET /boards/{boardSlug}/threads?cursor={cursor}&limit={n}, listing active threads by bump order.
+// @Summary List threads
+// @Description Get the active threads of a board, most recently bumped first, paginated by cursor
+// @Tags threads
+// @Produce json
+// @Param boardSlug path string true "Board slug"
+// @Param cursor query string false "Cursor from a previous page's next_cursor"
+// @Param limit query int false "Page size"
+// @Success 200 {object} PageResponse[PostView] "Page of threads (ModPostView items for moderators)"
+// @Failure 400 {string} string "Invalid cursor or limit"
+// @Failure 404 {string} string "Board not found"
+// @Failure 500 {string} string "Failed to list threads"
+// @Router /boards/{boardSlug}/threads [get]
+func listThreads(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		after, limit, err := parsePage(r, cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		board, err := models.GetBoardBySlug(ctx, db, chi.URLParam(r, "boardSlug"))
+		if err != nil {
+			http.Error(w, "Board not found", http.StatusNotFound)
+			return
+		}
+
+		threads, next, err := models.ListThreads(ctx, db, board.ID, after, limit)
+		if err != nil {
+			http.Error(w, "Failed to list threads", http.StatusInternalServerError)
+			return
+		}
+		threadIDs := make([]int, len(threads))
+		for i, t := range threads {
+			threadIDs[i] = t.ID
+		}
+		statuses, err := models.ThreadStatuses(ctx, db, threadIDs, threadLimits(board, cfg))
+		if err != nil {
+			http.Error(w, "Failed to list threads", http.StatusInternalServerError)
+			return
+		}
+		for i := range threads {
+			threads[i].Status = statuses[threads[i].ID]
+		}
+		var flagCounts map[int]int
+		mod := isModerator(getUser(r))
+		if mod {
+			if flagCounts, err = models.FlagCounts(ctx, db, threadIDs); err != nil {
+				http.Error(w, "Failed to list threads", http.StatusInternalServerError)
+				return
+			}
+		}
+		setViewerCaching(w, mod)
+		json.NewEncoder(w).Encode(newPageResponse(postViews(threads, mod, flagCounts), next))
+	}
+}
+
+// setThreadState handles PUT /threads/{threadID}/state, setting a thread's sticky,
+// locked and cyclical state.
+// @Summary Set thread state
+// @Description Pin a thread (sticky threads are listed first, lowest sticky value first; null unpins it), lock it against replies, or make it cyclical so the oldest replies are pruned past the reply limit. Moderators only.
+// @Tags threads
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param threadID path int true "Thread ID"
+// @Param state body object{sticky=int,locked=bool,cyclical=bool} true "Thread state"
+// @Success 200 {object} ModPostView "Updated thread"
+// @Failure 400 {string} string "Invalid thread ID or request body"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Moderator access required"
+// @Failure 404 {string} string "Thread not found or archived"
+// @Failure 500 {string} string "Failed to update thread"
+// @Router /threads/{threadID}/state [put]
+func setThreadState(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		threadID, err := parseInt(chi.URLParam(r, "threadID"))
+		if err != nil {
+			http.Error(w, "Invalid thread ID", http.StatusBadRequest)
+			return
+		}
+
+		var input struct {
+			Sticky   *int `json:"sticky"`
+			Locked   bool `json:"locked"`
+			Cyclical bool `json:"cyclical"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		thread, err := models.SetThreadState(ctx, db, threadID, input.Sticky, input.Locked, input.Cyclical)
+		if err != nil {
+			if err.Error() == "thread not found" {
+				http.Error(w, "Thread not found or archived", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to update thread", http.StatusInternalServerError)
+			return
+		}
+		publishEvent(ctx, db, models.EventThreadUpdated, thread.BoardID, thread.ID, nil, newPostView(thread))
+
+		flagCounts, err := modFlagCounts(r, db, thread)
+		if err != nil {
+			log.Error().Err(err).Int("thread_id", threadID).Msg("Failed to count flags")
+		}
+		json.NewEncoder(w).Encode(postView(thread, isModerator(getUser(r)), flagCounts))
+	}
 }
 
 // getThread handles GET /threads/{threadID}, retrieving a thread and its replies.
-func getThread(db *pgxpool.Pool) http.HandlerFunc {
+func getThread(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		threadID, err := parseInt(chi.URLParam(r, "threadID"))
@@ -32,38 +154,163 @@ func getThread(db *pgxpool.Pool) http.HandlerFunc {
 
 		// Get thread (original post)
 		thread, err := models.GetPost(ctx, db, threadID)
-		if err != nil || thread.ThreadID != nil || thread.ArchivedAt != nil {
+		if err != nil || thread.ThreadID != nil || thread.ArchivedAt != nil || thread.Deleted || thread.Expired() {
+			http.Error(w, "Thread not found or archived", http.StatusNotFound)
+			return
+		}
+
+		board, err := models.GetBoard(ctx, db, thread.BoardID)
+		if err != nil {
+			http.Error(w, "Failed to fetch replies", http.StatusInternalServerError)
+			return
+		}
+		serveThread(w, r, db, cfg, board, thread)
+	}
+}
+
+// getThreadByNumber handles GET /boards/{boardSlug}/threads/{threadNumber}, retrieving a
+// thread and its replies by the thread's board post number.
+// @Summary Get thread by number
+// @Description Get a thread and its replies by the board post number of its opening post
+// @Tags threads
+// @Produce json
+// @Param boardSlug path string true "Board slug"
+// @Param threadNumber path int true "Board post number of the thread"
+// @Param If-None-Match header string false "ETag of a cached response"
+// @Param If-Modified-Since header string false "Last-Modified of a cached response"
+// @Success 200 {object} ThreadResponse "Thread with replies"
+// @Success 304 {string} string "Not modified"
+// @Failure 400 {string} string "Invalid thread number"
+// @Failure 404 {string} string "Board not found, or thread not found or archived"
+// @Failure 500 {string} string "Failed to fetch replies"
+// @Router /boards/{boardSlug}/threads/{threadNumber} [get]
+func getThreadByNumber(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		number, err := parseInt(chi.URLParam(r, "threadNumber"))
+		if err != nil {
+			http.Error(w, "Invalid thread number", http.StatusBadRequest)
+			return
+		}
+
+		board, err := models.GetBoardBySlug(ctx, db, chi.URLParam(r, "boardSlug"))
+		if err != nil {
+			http.Error(w, "Board not found", http.StatusNotFound)
+			return
+		}
+		thread, err := models.GetPostByNumber(ctx, db, board.ID, number)
+		if err != nil || thread.ThreadID != nil || thread.ArchivedAt != nil || thread.Deleted || thread.Expired() {
 			http.Error(w, "Thread not found or archived", http.StatusNotFound)
 			return
 		}
+		serveThread(w, r, db, cfg, board, thread)
+	}
+}
+
+// serveThread writes a thread and its replies, or 304 if the client's copy is current.
+func serveThread(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, cfg config.Config, board *models.Board, thread *models.Post) {
+	ctx := r.Context()
+	threadID := thread.ID
+
+	// Skip loading replies when the client's copy is current
+	postCount, lastModified, err := models.ThreadVersion(ctx, db, threadID)
+	if err != nil {
+		http.Error(w, "Failed to fetch replies", http.StatusInternalServerError)
+		return
+	}
+	// Votes change the poll without touching any post, so its tallies are part of the version
+	if thread.Poll, err = models.GetPollByThread(ctx, db, threadID); err != nil {
+		http.Error(w, "Failed to fetch replies", http.StatusInternalServerError)
+		return
+	}
+	pollVersion := ""
+	if thread.Poll != nil {
+		pollVersion = fmt.Sprintf("%d:%t", thread.Poll.Voters, thread.Poll.Closed)
+	}
 
-		// Get replies
-		rows, err := db.Query(ctx,
-			"SELECT id, board_id, thread_id, user_id, title, content, image_url, metadata, created_at, updated_at, last_bumped_at, archived_at "+
-				"FROM posts WHERE thread_id = $1 AND archived_at IS NULL ORDER BY created_at ASC",
-			threadID,
-		)
+	mod := isModerator(getUser(r))
+	// Moderators also see flag counts, which change without touching any post
+	flagVersion := ""
+	if mod {
+		flags, latestFlag, err := models.ThreadFlagVersion(ctx, db, threadID)
 		if err != nil {
 			http.Error(w, "Failed to fetch replies", http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
+		flagVersion = fmt.Sprintf("%d:%d", flags, latestFlag.UnixNano())
+		if latestFlag.After(lastModified) {
+			lastModified = latestFlag
+		}
+	}
+	setViewerCaching(w, mod)
+	if notModified(w, r, makeETag("thread", threadID, postCount, lastModified.UnixNano(), board.UpdatedAt.UnixNano(), pollVersion, mod, flagVersion), lastModified) {
+		return
+	}
 
-		var replies []models.Post
-		for rows.Next() {
-			var p models.Post
-			if err := rows.Scan(&p.ID, &p.BoardID, &p.ThreadID, &p.UserID, &p.Title, &p.Content, &p.ImageURL, &p.Metadata,
-				&p.CreatedAt, &p.UpdatedAt, &p.LastBumpedAt, &p.ArchivedAt); err != nil {
-				http.Error(w, "Failed to scan replies", http.StatusInternalServerError)
-				return
-			}
-			replies = append(replies, p)
+	if thread.Status, err = models.GetThreadStatus(ctx, db, threadID, threadLimits(board, cfg)); err != nil {
+		http.Error(w, "Failed to fetch replies", http.StatusInternalServerError)
+		return
+	}
+
+	quotes, backlinks, err := models.ThreadQuotes(ctx, db, threadID)
+	if err != nil {
+		http.Error(w, "Failed to fetch replies", http.StatusInternalServerError)
+		return
+	}
+	thread.Quotes, thread.Backlinks = quotes[thread.ID], backlinks[thread.ID]
+
+	var flagCounts map[int]int
+	if mod {
+		if flagCounts, err = models.ThreadFlagCounts(ctx, db, threadID); err != nil {
+			http.Error(w, "Failed to fetch replies", http.StatusInternalServerError)
+			return
 		}
+	}
+
+	// Get replies
+	rows, err := db.Query(ctx,
+		"SELECT "+models.PostColumns+" FROM posts WHERE thread_id = $1 AND archived_at IS NULL ORDER BY number ASC",
+		threadID,
+	)
+	if err != nil {
+		http.Error(w, "Failed to fetch replies", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
 
-		response := ThreadResponse{
-			Thread:  *thread,
-			Replies: replies,
+	// Stream replies as they are scanned so memory stays flat for long threads
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := io.WriteString(w, `{"thread":`); err != nil {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(postView(thread, mod, flagCounts)); err != nil {
+		return
+	}
+	io.WriteString(w, `,"replies":`)
+	replies, err := newJSONArrayWriter(w)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var p models.Post
+		if err := models.ScanPost(rows, &p); err != nil {
+			// Headers are already sent, so the truncated body is all the client gets
+			log.Error().Err(err).Int("thread_id", threadID).Msg("Failed to scan replies")
+			return
+		}
+		p.Quotes, p.Backlinks = quotes[p.ID], backlinks[p.ID]
+		// Moderators see deleted replies as they were
+		if p.Deleted && !mod {
+			p.Tombstone()
 		}
-		json.NewEncoder(w).Encode(response)
+		if err := replies.Write(postView(&p, mod, flagCounts)); err != nil {
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Int("thread_id", threadID).Msg("Failed to fetch replies")
+		return
 	}
+	replies.Close()
+	io.WriteString(w, "}")
 }
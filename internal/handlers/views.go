@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cobalto/noppera/internal/middleware"
+	"github.com/cobalto/noppera/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostView is a post as shown to the public. It leaves out the poster's account and
+// everything else only moderators may see.
+type PostView struct {
+	ID            int                    `json:"id"`
+	BoardID       int                    `json:"board_id"`
+	Number        int                    `json:"number"`
+	ThreadID      *int                   `json:"thread_id"`
+	Name          *string                `json:"name"`
+	Tripcode      *string                `json:"tripcode"`
+	Capcode       *string                `json:"capcode,omitempty"`
+	PosterID      *string                `json:"poster_id"`
+	Title         *string                `json:"title"`
+	Content       string                 `json:"content"`
+	ContentHTML   string                 `json:"content_html"`
+	ImageURL      *string                `json:"image_url"`
+	Spoiler       bool                   `json:"spoiler"`
+	Metadata      map[string]interface{} `json:"metadata"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     *time.Time             `json:"updated_at"`
+	EditedAt      *time.Time             `json:"edited_at"`
+	Edited        bool                   `json:"edited"`
+	LastBumpedAt  time.Time              `json:"last_bumped_at"`
+	ArchivedAt    *time.Time             `json:"archived_at"`
+	ExpiresAt     *time.Time             `json:"expires_at,omitempty"`
+	ExpiresIn     *int                   `json:"expires_in,omitempty"`
+	Sage          bool                   `json:"sage"`
+	Sticky        *int                   `json:"sticky,omitempty"`
+	Locked        bool                   `json:"locked,omitempty"`
+	Cyclical      bool                   `json:"cyclical,omitempty"`
+	Deleted       bool                   `json:"deleted"`
+	DeletedAt     *time.Time             `json:"deleted_at,omitempty"`
+	FileDeletedAt *time.Time             `json:"file_deleted_at,omitempty"`
+	Status        *models.ThreadStatus   `json:"status,omitempty"`
+	Poll          *models.Poll           `json:"poll,omitempty"`
+	Quotes        []models.QuoteRef      `json:"quotes,omitempty"`
+	Backlinks     []models.QuoteRef      `json:"backlinks,omitempty"`
+	DeleteToken   string                 `json:"delete_token,omitempty"`
+}
+
+// ModPostView is a post as shown to moderators: the public view plus the poster's
+// account and IP hash, who deleted it and why, and how often it has been flagged.
+type ModPostView struct {
+	PostView
+	UserID       *int    `json:"user_id"`
+	IPHash       *string `json:"ip_hash"`
+	DeletedBy    *int    `json:"deleted_by,omitempty"`
+	DeleteReason *string `json:"delete_reason,omitempty"`
+	FlagCount    int     `json:"flag_count"`
+}
+
+// UserView is an account as returned by the API. It has no password field, so the
+// hash can never be serialized.
+type UserView struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	IsAdmin   bool      `json:"is_admin"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// newPostView builds the public view of a post.
+func newPostView(p *models.Post) PostView {
+	return PostView{
+		ID:            p.ID,
+		BoardID:       p.BoardID,
+		Number:        p.Number,
+		ThreadID:      p.ThreadID,
+		Name:          p.Name,
+		Tripcode:      p.Tripcode,
+		Capcode:       p.Capcode,
+		PosterID:      p.PosterID,
+		Title:         p.Title,
+		Content:       p.Content,
+		ContentHTML:   p.ContentHTML,
+		ImageURL:      p.ImageURL,
+		Spoiler:       p.Spoiler,
+		Metadata:      p.Metadata,
+		CreatedAt:     p.CreatedAt,
+		UpdatedAt:     p.UpdatedAt,
+		EditedAt:      p.EditedAt,
+		Edited:        p.Edited,
+		LastBumpedAt:  p.LastBumpedAt,
+		ArchivedAt:    p.ArchivedAt,
+		ExpiresAt:     p.ExpiresAt,
+		ExpiresIn:     remainingLifetime(p.ExpiresAt),
+		Sage:          p.Sage,
+		Sticky:        p.Sticky,
+		Locked:        p.Locked,
+		Cyclical:      p.Cyclical,
+		Deleted:       p.Deleted,
+		DeletedAt:     p.DeletedAt,
+		FileDeletedAt: p.FileDeletedAt,
+		Status:        p.Status,
+		Poll:          p.Poll,
+		Quotes:        p.Quotes,
+		Backlinks:     p.Backlinks,
+		DeleteToken:   p.DeleteToken,
+	}
+}
+
+// remainingLifetime returns the whole seconds left until an expiry time, or nil if
+// there is none.
+func remainingLifetime(expiresAt *time.Time) *int {
+	if expiresAt == nil {
+		return nil
+	}
+	seconds := int(time.Until(*expiresAt) / time.Second)
+	if seconds < 0 {
+		seconds = 0
+	}
+	return &seconds
+}
+
+// newModPostView builds the moderator view of a post.
+func newModPostView(p *models.Post, flagCount int) ModPostView {
+	return ModPostView{
+		PostView:     newPostView(p),
+		UserID:       p.UserID,
+		IPHash:       p.IPHash,
+		DeletedBy:    p.DeletedBy,
+		DeleteReason: p.DeleteReason,
+		FlagCount:    flagCount,
+	}
+}
+
+// postView picks the view of a post for the caller: ModPostView for moderators with
+// the post's entry from flagCounts, PostView for everyone else.
+func postView(p *models.Post, mod bool, flagCounts map[int]int) interface{} {
+	if mod {
+		return newModPostView(p, flagCounts[p.ID])
+	}
+	return newPostView(p)
+}
+
+// postViews picks the views of a list of posts for the caller, as postView does.
+func postViews(posts []models.Post, mod bool, flagCounts map[int]int) []interface{} {
+	views := make([]interface{}, len(posts))
+	for i := range posts {
+		views[i] = postView(&posts[i], mod, flagCounts)
+	}
+	return views
+}
+
+// newUserView builds the API view of an account.
+func newUserView(u *models.User) UserView {
+	return UserView{
+		ID:        u.ID,
+		Username:  u.Username,
+		IsAdmin:   u.IsAdmin,
+		Role:      u.Role,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+// isModerator reports whether a user has the mod or admin role. Anonymous callers,
+// passed as nil, never do.
+func isModerator(user *middleware.User) bool {
+	return user != nil && models.RoleAtLeast(user.EffectiveRole(), models.RoleMod)
+}
+
+// modFlagCounts loads the flag counts of posts for moderators; the public views do not
+// use them, so nothing is queried for anyone else.
+func modFlagCounts(r *http.Request, db *pgxpool.Pool, posts ...*models.Post) (map[int]int, error) {
+	if !isModerator(getUser(r)) {
+		return nil, nil
+	}
+	ids := make([]int, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	return models.FlagCounts(r.Context(), db, ids)
+}
+
+// setViewerCaching marks a cacheable response as depending on the caller's role, so
+// shared caches never hand a moderator view to the public.
+func setViewerCaching(w http.ResponseWriter, mod bool) {
+	w.Header().Add("Vary", "Authorization")
+	if mod {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/events"
+	"github.com/cobalto/noppera/internal/middleware"
+	"github.com/cobalto/noppera/internal/models"
+	"github.com/cobalto/noppera/internal/storage"
+	"github.com/didip/tollbooth/v7/limiter"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/time/rate"
+)
+
+const (
+	wsWriteWait        = 10 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsPingPeriod       = (wsPongWait * 9) / 10
+	wsOutboxSize       = 16
+	wsMaxSubscriptions = 50
+)
+
+// RegisterWebSocket sets up the WebSocket API route. Replies sent over WebSockets are
+// counted against postLimiter, the limiter of the HTTP reply route.
+func RegisterWebSocket(r chi.Router, db *pgxpool.Pool, store storage.Storage, broker *events.Broker, postLimiter *limiter.Limiter) {
+	r.With(middleware.WebSocketAuth(store.Config())).Get("/ws", serveWebSocket(db, store, broker, postLimiter))
+}
+
+// wsClientMessage is a message sent by a WebSocket client. The optional ID is echoed
+// back on the response so clients can correlate requests.
+type wsClientMessage struct {
+	Type     string   `json:"type"`
+	ID       string   `json:"id,omitempty"`
+	Boards   []string `json:"boards,omitempty"`
+	Threads  []int    `json:"threads,omitempty"`
+	ThreadID int      `json:"thread_id,omitempty"`
+	replyInput
+}
+
+// wsServerMessage is a message sent to a WebSocket client.
+type wsServerMessage struct {
+	Type    string        `json:"type"`
+	ID      string        `json:"id,omitempty"`
+	Event   *models.Event `json:"event,omitempty"`
+	Post    interface{}   `json:"post,omitempty"`
+	Boards  []string      `json:"boards,omitempty"`
+	Threads []int         `json:"threads,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// wsClient holds the state of a single WebSocket connection.
+type wsClient struct {
+	conn    *websocket.Conn
+	db      *pgxpool.Pool
+	store   storage.Storage
+	broker  *events.Broker
+	user    *middleware.User
+	ip      string
+	sub     *events.Subscription
+	outbox  chan wsServerMessage
+	limiter *rate.Limiter
+	posts   *limiter.Limiter
+	cancel  context.CancelFunc
+}
+
+// serveWebSocket handles GET /ws, upgrading to a WebSocket for subscriptions and posting.
+// @Summary WebSocket API
+// @Description Upgrade to a WebSocket. Clients send JSON messages of type "subscribe" or "unsubscribe" (with boards and threads) and "reply" (with thread_id, content, image, tags, metadata), and receive "event", "subscribed", "unsubscribed", "posted" and "error" messages. The token may be passed in the access_token query parameter.
+// @Tags events
+// @Security BearerAuth
+// @Param access_token query string false "JWT, for clients that cannot set headers"
+// @Success 101 {string} string "Switching protocols"
+// @Failure 401 {string} string "Unauthorized"
+// @Router /ws [get]
+func serveWebSocket(db *pgxpool.Pool, store storage.Storage, broker *events.Broker, postLimiter *limiter.Limiter) http.HandlerFunc {
+	cfg := store.Config()
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || middleware.OriginAllowed(cfg, origin)
+		},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(middleware.UserContextKey).(*middleware.User)
+		if !ok || user.ID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Upgrade replies to the client itself on failure
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		c := &wsClient{
+			conn:    conn,
+			db:      db,
+			store:   store,
+			broker:  broker,
+			user:    user,
+			ip:      middleware.ClientIP(r),
+			outbox:  make(chan wsServerMessage, wsOutboxSize),
+			limiter: rate.NewLimiter(rate.Limit(float64(cfg.WSRateLimitMessages)/60.0), cfg.WSRateLimitBurst),
+			posts:   postLimiter,
+		}
+		c.serve(r.Context(), cfg)
+	}
+}
+
+// serve runs the connection until either side closes it.
+func (c *wsClient) serve(ctx context.Context, cfg config.Config) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	defer c.cancel()
+
+	c.sub = c.broker.Subscribe(nil, nil)
+	defer c.broker.Unsubscribe(c.sub)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.writeLoop(ctx)
+	}()
+	c.readLoop(ctx, cfg)
+	c.cancel()
+	<-done
+}
+
+// readLoop reads and handles client messages, applying the per-connection rate limit.
+func (c *wsClient) readLoop(ctx context.Context, cfg config.Config) {
+	// Leave room for a base64 encoded image at the default size limit
+	c.conn.SetReadLimit(int64(cfg.DefaultMaxImageSize)*4/3 + int64(cfg.MaxPostLength) + 64*1024)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.send(wsServerMessage{Type: "error", Error: "Invalid message"})
+			continue
+		}
+		if !c.limiter.Allow() {
+			c.send(wsServerMessage{Type: "error", ID: msg.ID, Error: "Rate limit exceeded"})
+			continue
+		}
+		c.handle(ctx, msg)
+	}
+}
+
+// writeLoop is the only writer on the connection: it delivers subscribed events,
+// responses and keepalive pings, and closes the connection when it returns.
+func (c *wsClient) writeLoop(ctx context.Context) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	defer c.conn.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.writeClose(websocket.CloseNormalClosure, "")
+			return
+		case ev, ok := <-c.sub.Events():
+			if !ok {
+				// Dropped by the broker for falling behind
+				c.writeClose(websocket.CloseTryAgainLater, "Too slow to receive events")
+				return
+			}
+			if err := c.write(wsServerMessage{Type: "event", Event: &ev}); err != nil {
+				return
+			}
+		case msg := <-c.outbox:
+			if err := c.write(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// write sends a single JSON message.
+func (c *wsClient) write(msg wsServerMessage) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteJSON(msg)
+}
+
+// writeClose sends a close frame, ignoring errors since the connection is going away.
+func (c *wsClient) writeClose(code int, text string) {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait))
+}
+
+// send queues a response, disconnecting clients that do not read their responses.
+func (c *wsClient) send(msg wsServerMessage) {
+	select {
+	case c.outbox <- msg:
+	default:
+		c.cancel()
+	}
+}
+
+// handle dispatches a client message by type.
+func (c *wsClient) handle(ctx context.Context, msg wsClientMessage) {
+	switch msg.Type {
+	case "subscribe":
+		c.subscribe(ctx, msg)
+	case "unsubscribe":
+		c.unsubscribe(ctx, msg)
+	case "reply":
+		// Count the reply per IP as if it were posted over HTTP, so neither the socket
+		// nor opening more of them gets around the posting limit
+		if !middleware.Allow(c.posts, c.ip, fmt.Sprintf("/threads/%d/replies", msg.ThreadID)) {
+			c.send(wsServerMessage{Type: "error", ID: msg.ID, Error: "Rate limit exceeded"})
+			return
+		}
+		post, err := submitReply(ctx, c.db, c.store, msg.ThreadID, msg.replyInput, c.user, c.ip)
+		if err != nil {
+			message := "Failed to create reply"
+			var pe *postError
+			if errors.As(err, &pe) {
+				message = pe.message
+			}
+			c.send(wsServerMessage{Type: "error", ID: msg.ID, Error: message})
+			return
+		}
+		c.send(wsServerMessage{Type: "posted", ID: msg.ID, Post: postView(post, isModerator(c.user), nil)})
+	default:
+		c.send(wsServerMessage{Type: "error", ID: msg.ID, Error: "Unknown message type"})
+	}
+}
+
+// subscribe adds boards and threads to the connection's subscription.
+func (c *wsClient) subscribe(ctx context.Context, msg wsClientMessage) {
+	if c.broker.Size(c.sub)+len(msg.Boards)+len(msg.Threads) > wsMaxSubscriptions {
+		c.send(wsServerMessage{Type: "error", ID: msg.ID, Error: "Too many subscriptions"})
+		return
+	}
+
+	boardIDs := make([]int, 0, len(msg.Boards))
+	for _, slug := range msg.Boards {
+		board, err := models.GetBoardBySlug(ctx, c.db, slug)
+		if err != nil {
+			c.send(wsServerMessage{Type: "error", ID: msg.ID, Error: "Board not found: " + slug})
+			return
+		}
+		boardIDs = append(boardIDs, board.ID)
+	}
+	for _, threadID := range msg.Threads {
+		thread, err := models.GetPost(ctx, c.db, threadID)
+		if err != nil || thread.ThreadID != nil || thread.ArchivedAt != nil || thread.Deleted || thread.Expired() {
+			c.send(wsServerMessage{Type: "error", ID: msg.ID, Error: "Thread not found or archived"})
+			return
+		}
+	}
+
+	if !c.broker.Add(c.sub, boardIDs, msg.Threads) {
+		// Dropped by the broker for falling behind; the connection is closing
+		c.send(wsServerMessage{Type: "error", ID: msg.ID, Error: "Subscription closed"})
+		return
+	}
+	c.send(wsServerMessage{Type: "subscribed", ID: msg.ID, Boards: msg.Boards, Threads: msg.Threads})
+}
+
+// unsubscribe removes boards and threads from the connection's subscription.
+func (c *wsClient) unsubscribe(ctx context.Context, msg wsClientMessage) {
+	boardIDs := make([]int, 0, len(msg.Boards))
+	for _, slug := range msg.Boards {
+		if board, err := models.GetBoardBySlug(ctx, c.db, slug); err == nil {
+			boardIDs = append(boardIDs, board.ID)
+		}
+	}
+	c.broker.Remove(c.sub, boardIDs, msg.Threads)
+	c.send(wsServerMessage{Type: "unsubscribed", ID: msg.ID, Boards: msg.Boards, Threads: msg.Threads})
+}
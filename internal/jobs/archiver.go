@@ -2,11 +2,13 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/cobalto/noppera/internal/config"
 	"github.com/cobalto/noppera/internal/models"
+	"github.com/cobalto/noppera/internal/purge"
 	"github.com/cobalto/noppera/internal/storage"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/robfig/cron/v3"
@@ -37,6 +39,11 @@ func (a *Archiver) Start() {
 	if err != nil {
 		panic(fmt.Errorf("failed to schedule archiver: %w", err))
 	}
+	// Expired threads should disappear promptly, so they are checked far more often
+	_, err = a.cron.AddFunc(fmt.Sprintf("@every %s", a.cfg.ThreadExpiryInterval), a.purgeExpiredThreads)
+	if err != nil {
+		panic(fmt.Errorf("failed to schedule thread expiry: %w", err))
+	}
 	a.cron.Start()
 }
 
@@ -58,54 +65,144 @@ func (a *Archiver) run() {
 	if err := a.deleteOldThreads(ctx); err != nil {
 		fmt.Printf("Archiver: failed to delete old threads: %v\n", err)
 	}
+
+	// Purge posts soft-deleted more than PURGE_DELETED_DAYS ago
+	if err := a.purgeDeletedPosts(ctx); err != nil {
+		fmt.Printf("Archiver: failed to purge deleted posts: %v\n", err)
+	}
+
+	// Retry removing files that earlier purges could not delete from storage
+	if err := purge.RetryFiles(ctx, a.db, a.store); err != nil {
+		fmt.Printf("Archiver: failed to retry file deletions: %v\n", err)
+	}
+
+	// Drop live events older than EVENT_RETENTION_HOURS
+	if err := models.DeleteEventsBefore(ctx, a.db, time.Now().Add(-time.Duration(a.cfg.EventRetentionHours)*time.Hour)); err != nil {
+		fmt.Printf("Archiver: failed to prune events: %v\n", err)
+	}
 }
 
-// archiveThreads marks threads as archived if inactive for 7 days.
+// archiveThreads marks threads as archived if inactive for 7 days. Sticky and cyclical
+// threads are meant to stay up, so they are never archived.
 func (a *Archiver) archiveThreads(ctx context.Context) error {
 	archiveThreshold := time.Now().Add(-7 * 24 * time.Hour)
-	_, err := a.db.Exec(ctx,
-		"UPDATE posts SET archived_at = $1 WHERE thread_id IS NULL AND archived_at IS NULL AND last_bumped_at < $2",
+	rows, err := a.db.Query(ctx,
+		"UPDATE posts SET archived_at = $1 WHERE thread_id IS NULL AND archived_at IS NULL AND last_bumped_at < $2 "+
+			"AND sticky IS NULL AND NOT cyclical "+
+			"RETURNING id, board_id, archived_at",
 		time.Now(), archiveThreshold,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to archive threads: %w", err)
 	}
+
+	var archived []models.Event
+	for rows.Next() {
+		var id, boardID int
+		var archivedAt time.Time
+		if err := rows.Scan(&id, &boardID, &archivedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan archived thread: %w", err)
+		}
+		payload, _ := json.Marshal(map[string]interface{}{"id": id, "archived_at": archivedAt})
+		archived = append(archived, models.Event{
+			Type:     models.EventThreadUpdated,
+			BoardID:  boardID,
+			ThreadID: id,
+			Payload:  payload,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to archive threads: %w", err)
+	}
+
+	// Let live subscribers know the threads are now read-only
+	for i := range archived {
+		if err := models.CreateEvent(ctx, a.db, &archived[i]); err != nil {
+			fmt.Printf("Archiver: failed to publish archive of thread %d: %v\n", archived[i].ThreadID, err)
+		}
+	}
 	return nil
 }
 
-// deleteOldThreads deletes archived threads older than ARCHIVE_DELETE_DAYS.
+// deleteOldThreads purges archived threads older than ARCHIVE_DELETE_DAYS, with their
+// replies and all of their images.
 func (a *Archiver) deleteOldThreads(ctx context.Context) error {
 	deleteThreshold := time.Now().Add(-time.Duration(a.cfg.ArchiveDeleteDays) * 24 * time.Hour)
 	rows, err := a.db.Query(ctx,
-		"SELECT id, image_url FROM posts WHERE archived_at < $1 AND thread_id IS NULL",
+		"SELECT id FROM posts WHERE archived_at < $1 AND thread_id IS NULL",
 		deleteThreshold,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to query old threads: %w", err)
 	}
-	defer rows.Close()
-
+	var ids []int
 	for rows.Next() {
 		var id int
-		var imageURL *string
-		if err := rows.Scan(&id, &imageURL); err != nil {
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
 			return fmt.Errorf("failed to scan thread: %w", err)
 		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query old threads: %w", err)
+	}
 
-		// Delete associated images
-		if imageURL != nil {
-			if err := a.store.Delete(ctx, *imageURL); err != nil {
-				fmt.Printf("Archiver: failed to delete image for thread %d: %v\n", id, err)
-				continue
-			}
-		}
-
-		// Delete thread and replies
-		if err := models.DeletePost(ctx, a.db, id); err != nil {
+	for _, id := range ids {
+		if err := purge.Post(ctx, a.db, a.store, id); err != nil {
 			fmt.Printf("Archiver: failed to delete thread %d: %v\n", id, err)
-			continue
 		}
 	}
+	return nil
+}
 
+// purgeDeletedPosts permanently deletes posts soft-deleted more than PURGE_DELETED_DAYS
+// ago, along with their images. Purging a thread takes its replies with it.
+func (a *Archiver) purgeDeletedPosts(ctx context.Context) error {
+	purgeThreshold := time.Now().Add(-time.Duration(a.cfg.PurgeDeletedDays) * 24 * time.Hour)
+	posts, err := models.ListPurgeable(ctx, a.db, purgeThreshold)
+	if err != nil {
+		return fmt.Errorf("failed to query deleted posts: %w", err)
+	}
+
+	for _, post := range posts {
+		if err := purge.Post(ctx, a.db, a.store, post.ID); err != nil {
+			fmt.Printf("Archiver: failed to purge post %d: %v\n", post.ID, err)
+		}
+	}
 	return nil
 }
+
+// purgeExpiredThreads permanently deletes threads whose expiry time has passed, with
+// their replies and images. Expired threads are purged rather than archived, and live
+// subscribers are told they are gone.
+func (a *Archiver) purgeExpiredThreads() {
+	ctx := context.Background()
+	threads, err := models.ListExpiredThreads(ctx, a.db, time.Now())
+	if err != nil {
+		fmt.Printf("Archiver: failed to query expired threads: %v\n", err)
+		return
+	}
+
+	for i := range threads {
+		id := threads[i].ID
+		if err := purge.Post(ctx, a.db, a.store, id); err != nil {
+			fmt.Printf("Archiver: failed to purge expired thread %d: %v\n", id, err)
+			continue
+		}
+		payload, _ := json.Marshal(map[string]interface{}{"id": id})
+		event := models.Event{
+			Type:     models.EventPostDeleted,
+			BoardID:  threads[i].BoardID,
+			ThreadID: id,
+			PostID:   &id,
+			Payload:  payload,
+		}
+		if err := models.CreateEvent(ctx, a.db, &event); err != nil {
+			fmt.Printf("Archiver: failed to publish expiry of thread %d: %v\n", id, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package markup
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// MaxReferences caps how many distinct posts a single post may quote.
+const MaxReferences = 20
+
+// quotePattern matches >>123 and cross-board >>>/board/123 references.
+var quotePattern = regexp.MustCompile(`>>(?:>/([A-Za-z0-9]+)/)?(\d+)`)
+
+// Reference is a quote of another post by its board post number, found in post
+// content. Board is empty for plain >>123 references, which point at the quoting
+// post's own board.
+type Reference struct {
+	Board  string
+	Number int
+}
+
+// ParseReferences returns the distinct post references in content, in order of first
+// appearance and capped at MaxReferences.
+func ParseReferences(content string) []Reference {
+	var refs []Reference
+	seen := make(map[Reference]bool)
+	for _, m := range quotePattern.FindAllStringSubmatch(content, -1) {
+		number, err := strconv.Atoi(m[2])
+		if err != nil || number <= 0 {
+			continue
+		}
+		ref := Reference{Board: m[1], Number: number}
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+		if len(refs) == MaxReferences {
+			break
+		}
+	}
+	return refs
+}
@@ -0,0 +1,144 @@
+package markup
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Options selects which markup is rendered; disabled markup is left as plain text.
+type Options struct {
+	Greentext bool
+	Quotes    bool
+	Spoilers  bool
+	Code      bool
+	Autolink  bool
+}
+
+// AllOptions enables every kind of markup.
+var AllOptions = Options{Greentext: true, Quotes: true, Spoilers: true, Code: true, Autolink: true}
+
+// QuoteResolver returns the link target of a quote reference, or false if the
+// referenced post could not be resolved.
+type QuoteResolver func(ref Reference) (href string, ok bool)
+
+var (
+	// codePattern matches [code] blocks, which are rendered verbatim.
+	codePattern = regexp.MustCompile(`(?s)\[code\](.*?)\[/code\]`)
+	// inlinePattern matches quote references, URLs and spoiler tags within a line.
+	inlinePattern = regexp.MustCompile(`>>(?:>/([A-Za-z0-9]+)/)?(\d+)|https?://[^\s<>"'\[\]]+|\[/?spoiler\]`)
+	// greentextPattern matches lines quoting text rather than a post.
+	greentextPattern = regexp.MustCompile(`^>(?:[^>]|>[^>\d]|$)`)
+)
+
+// Render converts raw post content into sanitized HTML. All text is escaped; the only
+// markup produced is greentext and spoiler spans, quote links, nofollow autolinks,
+// <pre><code> blocks and <br> line breaks.
+func Render(content string, opts Options, resolve QuoteResolver) string {
+	var b strings.Builder
+	r := &renderer{b: &b, opts: opts, resolve: resolve}
+
+	if !opts.Code {
+		r.text(content)
+		return b.String()
+	}
+
+	last := 0
+	for _, m := range codePattern.FindAllStringSubmatchIndex(content, -1) {
+		r.text(content[last:m[0]])
+		code := strings.TrimPrefix(content[m[2]:m[3]], "\n")
+		b.WriteString(`<pre><code>`)
+		b.WriteString(html.EscapeString(code))
+		b.WriteString(`</code></pre>`)
+		last = m[1]
+	}
+	r.text(content[last:])
+	return b.String()
+}
+
+// renderer accumulates HTML and carries spoiler state across lines.
+type renderer struct {
+	b       *strings.Builder
+	opts    Options
+	resolve QuoteResolver
+	spoiler int
+}
+
+// text renders a run of non-code content line by line.
+func (r *renderer) text(s string) {
+	s = strings.Trim(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return
+	}
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			r.b.WriteString("<br>")
+		}
+		r.line(line)
+	}
+}
+
+// line renders a single line, wrapping greentext and keeping spoiler spans balanced
+// within it so the output is always well formed.
+func (r *renderer) line(line string) {
+	green := r.opts.Greentext && greentextPattern.MatchString(line)
+	if green {
+		r.b.WriteString(`<span class="greentext">`)
+	}
+	open := r.spoiler
+	r.b.WriteString(strings.Repeat(`<span class="spoiler">`, open))
+
+	last := 0
+	for _, m := range inlinePattern.FindAllStringSubmatchIndex(line, -1) {
+		r.b.WriteString(html.EscapeString(line[last:m[0]]))
+		r.token(line[m[0]:m[1]], line, m)
+		last = m[1]
+	}
+	r.b.WriteString(html.EscapeString(line[last:]))
+
+	r.b.WriteString(strings.Repeat(`</span>`, r.spoiler))
+	if green {
+		r.b.WriteString(`</span>`)
+	}
+}
+
+// token renders one inline match, falling back to escaped text when its markup is disabled.
+func (r *renderer) token(tok, line string, m []int) {
+	switch {
+	case tok == "[spoiler]" && r.opts.Spoilers:
+		r.spoiler++
+		r.b.WriteString(`<span class="spoiler">`)
+	case tok == "[/spoiler]" && r.opts.Spoilers && r.spoiler > 0:
+		r.spoiler--
+		r.b.WriteString(`</span>`)
+	case strings.HasPrefix(tok, ">>") && r.opts.Quotes:
+		ref := Reference{Number: -1}
+		if m[2] >= 0 {
+			ref.Board = line[m[2]:m[3]]
+		}
+		if number, err := strconv.Atoi(line[m[4]:m[5]]); err == nil {
+			ref.Number = number
+		}
+		if href, ok := r.lookup(ref); ok {
+			r.b.WriteString(`<a class="quotelink" href="` + html.EscapeString(href) + `">` + html.EscapeString(tok) + `</a>`)
+		} else {
+			r.b.WriteString(`<span class="deadlink">` + html.EscapeString(tok) + `</span>`)
+		}
+	case strings.HasPrefix(tok, "http") && r.opts.Autolink:
+		// Leave sentence punctuation outside the link
+		url := strings.TrimRight(tok, ".,;:!?)")
+		r.b.WriteString(`<a href="` + html.EscapeString(url) + `" rel="nofollow noopener noreferrer" target="_blank">` + html.EscapeString(url) + `</a>`)
+		r.b.WriteString(html.EscapeString(tok[len(url):]))
+	default:
+		r.b.WriteString(html.EscapeString(tok))
+	}
+}
+
+// lookup resolves a quote reference through the caller's resolver.
+func (r *renderer) lookup(ref Reference) (string, bool) {
+	if r.resolve == nil || ref.Number <= 0 {
+		return "", false
+	}
+	return r.resolve(ref)
+}
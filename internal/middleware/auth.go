@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/cobalto/noppera/internal/config"
+	"github.com/cobalto/noppera/internal/models"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -14,9 +16,19 @@ type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
 	IsAdmin  bool   `json:"is_admin"`
+	Role     string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// EffectiveRole returns the user's role. Tokens issued before roles existed only
+// carry is_admin, which is read as the admin role.
+func (u *User) EffectiveRole() string {
+	if u.Role == "" && u.IsAdmin {
+		return models.RoleAdmin
+	}
+	return u.Role
+}
+
 // UserContextKey is the context key for the user.
 var UserContextKey = struct{}{}
 
@@ -30,19 +42,9 @@ func Auth(cfg config.Config) func(http.Handler) http.Handler {
 				return
 			}
 
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := jwt.ParseWithClaims(tokenString, &User{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(cfg.JWTSecret), nil
-			})
-
-			if err != nil || !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
-			}
-
-			claims, ok := token.Claims.(*User)
-			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			claims, err := ParseToken(cfg, strings.TrimPrefix(authHeader, "Bearer "))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
 
@@ -52,6 +54,54 @@ func Auth(cfg config.Config) func(http.Handler) http.Handler {
 	}
 }
 
+// OptionalAuth middleware attaches the JWT user to the request like Auth when a valid
+// token is present, and lets the request through anonymously otherwise.
+func OptionalAuth(cfg config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if strings.HasPrefix(authHeader, "Bearer ") {
+				if claims, err := ParseToken(cfg, strings.TrimPrefix(authHeader, "Bearer ")); err == nil {
+					r = r.WithContext(context.WithValue(r.Context(), UserContextKey, claims))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WebSocketAuth middleware verifies JWT tokens like Auth, additionally accepting the
+// token in the access_token query parameter since browsers cannot set headers on upgrades.
+func WebSocketAuth(cfg config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				if token := r.URL.Query().Get("access_token"); token != "" {
+					r = r.Clone(r.Context())
+					r.Header.Set("Authorization", "Bearer "+token)
+				}
+			}
+			Auth(cfg)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// ParseToken validates a signed JWT and returns its user claims.
+func ParseToken(cfg config.Config, tokenString string) (*User, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &User{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("Invalid token")
+	}
+
+	claims, ok := token.Claims.(*User)
+	if !ok {
+		return nil, errors.New("Invalid token claims")
+	}
+	return claims, nil
+}
+
 // AdminOnly middleware restricts access to admin users.
 func AdminOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -63,3 +113,15 @@ func AdminOnly(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// ModOnly middleware restricts access to moderators: users with the mod or admin role.
+func ModOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(UserContextKey).(*User)
+		if !ok || !models.RoleAtLeast(user.EffectiveRole(), models.RoleMod) {
+			http.Error(w, "Moderator access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cobalto/noppera/internal/config"
+)
+
+// compressibleTypes lists the response media types worth compressing.
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/javascript": true,
+	"application/xml":        true,
+	"image/svg+xml":          true,
+	"text/css":               true,
+	"text/html":              true,
+	"text/plain":             true,
+	"text/xml":               true,
+}
+
+// Compress creates middleware that gzip-encodes responses for clients that accept it.
+// Event streams and WebSocket upgrades are passed through untouched.
+func Compress(cfg config.Config) func(http.Handler) http.Handler {
+	level := cfg.CompressionLevel
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	pool := &sync.Pool{
+		New: func() interface{} {
+			gz, _ := gzip.NewWriterLevel(nil, level)
+			return gz
+		},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, pool: pool}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, with an explicit
+// gzip entry taking precedence over a wildcard.
+func acceptsGzip(header string) bool {
+	gzipQ, starQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip":
+			gzipQ = q
+		case "*":
+			starQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return starQ > 0
+}
+
+// compressWriter decides on the first write whether the response is compressible and,
+// if so, routes the body through a pooled gzip writer.
+type compressWriter struct {
+	http.ResponseWriter
+	pool    *sync.Pool
+	gz      *gzip.Writer
+	decided bool
+}
+
+// WriteHeader decides on compression before the headers are sent.
+func (cw *compressWriter) WriteHeader(code int) {
+	if !cw.decided {
+		cw.decide(code)
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// Write compresses the body when compression was chosen.
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		// Sniff now, since the client would otherwise be told the type of the gzip stream
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush pushes buffered compressed data to the client.
+func (cw *compressWriter) Flush() {
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close finishes the gzip stream and returns the writer to the pool.
+func (cw *compressWriter) Close() {
+	if cw.gz == nil {
+		return
+	}
+	cw.gz.Close()
+	cw.pool.Put(cw.gz)
+	cw.gz = nil
+}
+
+// decide enables compression for bodies of compressible types that are not already encoded.
+func (cw *compressWriter) decide(code int) {
+	cw.decided = true
+	h := cw.Header()
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified || h.Get("Content-Encoding") != "" {
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil || !compressibleTypes[mediaType] {
+		return
+	}
+
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	// The encoded body differs byte-for-byte, so only a weak validator still holds
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+
+	cw.gz = cw.pool.Get().(*gzip.Writer)
+	cw.gz.Reset(cw.ResponseWriter)
+}
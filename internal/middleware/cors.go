@@ -12,28 +12,14 @@ func CORS(cfg config.Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Set CORS headers
-			origins := strings.Split(cfg.CORSAllowedOrigins, ",")
 			origin := r.Header.Get("Origin")
-
-			// Check if origin is allowed
-			allowed := false
-			if cfg.CORSAllowedOrigins == "*" {
-				allowed = true
-			} else {
-				for _, allowedOrigin := range origins {
-					if strings.TrimSpace(allowedOrigin) == origin {
-						allowed = true
-						break
-					}
-				}
-			}
-
-			if allowed {
+			if OriginAllowed(cfg, origin) {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 			}
 
 			w.Header().Set("Access-Control-Allow-Methods", cfg.CORSAllowedMethods)
 			w.Header().Set("Access-Control-Allow-Headers", cfg.CORSAllowedHeaders)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified")
 
 			if cfg.CORSAllowCredentials {
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
@@ -49,3 +35,16 @@ func CORS(cfg config.Config) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// OriginAllowed reports whether the origin is listed in CORS_ALLOWED_ORIGINS.
+func OriginAllowed(cfg config.Config, origin string) bool {
+	if cfg.CORSAllowedOrigins == "*" {
+		return true
+	}
+	for _, allowedOrigin := range strings.Split(cfg.CORSAllowedOrigins, ",") {
+		if strings.TrimSpace(allowedOrigin) == origin {
+			return true
+		}
+	}
+	return false
+}
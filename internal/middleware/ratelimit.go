@@ -6,17 +6,22 @@ import (
 
 	"github.com/cobalto/noppera/internal/config"
 	"github.com/didip/tollbooth/v7"
+	"github.com/didip/tollbooth/v7/libstring"
 	"github.com/didip/tollbooth/v7/limiter"
 )
 
-// RateLimit creates middleware to limit requests based on config.
-func RateLimit(cfg config.Config) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		// Configure limiter: requests per second with burst
-		lim := tollbooth.NewLimiter(float64(cfg.RateLimitRequests)/3600.0, &limiter.ExpirableOptions{
-			DefaultExpirationTTL: 3600 * time.Second,
-		}).SetBurst(cfg.RateLimitBurst).SetIPLookups([]string{"RemoteAddr", "X-Forwarded-For", "X-Real-IP"})
+// NewLimiter creates the per-IP, per-path limiter configured by RATE_LIMIT_REQUESTS
+// and RATE_LIMIT_BURST.
+func NewLimiter(cfg config.Config) *limiter.Limiter {
+	// Configure limiter: requests per second with burst
+	return tollbooth.NewLimiter(float64(cfg.RateLimitRequests)/3600.0, &limiter.ExpirableOptions{
+		DefaultExpirationTTL: 3600 * time.Second,
+	}).SetBurst(cfg.RateLimitBurst).SetIPLookups([]string{"RemoteAddr"}) // RealIP has already resolved proxied clients
+}
 
+// RateLimit creates middleware to limit requests with the given limiter.
+func RateLimit(lim *limiter.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Apply rate-limiting
 			httpError := tollbooth.LimitByRequest(lim, w, r)
@@ -30,8 +35,15 @@ func RateLimit(cfg config.Config) func(http.Handler) http.Handler {
 }
 
 // RateLimitPublic applies rate-limiting to public endpoints.
-func RateLimitPublic(cfg config.Config) func(http.Handler) http.Handler {
+func RateLimitPublic(lim *limiter.Limiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		return RateLimit(cfg)(next)
+		return RateLimit(lim)(next)
 	}
 }
+
+// Allow takes a token from lim for a client IP and path outside of an HTTP request,
+// such as a WebSocket message, using the same key as RateLimit would for a request to
+// that path. It returns false once the client is over the limit.
+func Allow(lim *limiter.Limiter, ip, path string) bool {
+	return tollbooth.LimitByKeys(lim, []string{libstring.CanonicalizeIP(ip), path, ""}) == nil
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cobalto/noppera/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// RealIP creates middleware that replaces r.RemoteAddr with the client address
+// forwarded by a trusted proxy. X-Forwarded-For is read right to left and the first
+// hop that is not a trusted proxy is taken as the client, so addresses prepended by
+// the client itself are ignored. Requests from untrusted peers are left unchanged.
+func RealIP(cfg config.Config) func(http.Handler) http.Handler {
+	trusted := parseTrustedProxies(cfg.TrustedProxies)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(trusted) > 0 && isTrusted(trusted, ClientIP(r)) {
+				if ip := forwardedIP(r, trusted); ip != "" {
+					_, port, err := net.SplitHostPort(r.RemoteAddr)
+					if err != nil {
+						port = "0"
+					}
+					r.RemoteAddr = net.JoinHostPort(ip, port)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the client IP address of a request, without the port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedIP picks the client address from the proxy headers.
+func forwardedIP(r *http.Request, trusted []*net.IPNet) string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			// A malformed hop means nothing left of it can be trusted
+			return ""
+		}
+		if i == 0 || !isTrusted(trusted, ip.String()) {
+			return ip.String()
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// isTrusted reports whether ip belongs to one of the trusted proxy networks.
+func isTrusted(trusted []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses a comma-separated list of IPs and CIDR ranges.
+func parseTrustedProxies(list string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Warn().Str("proxy", entry).Msg("Ignoring invalid trusted proxy")
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -2,8 +2,10 @@ package models
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -15,31 +17,101 @@ type Board struct {
 	Description string                 `json:"description"`
 	Settings    map[string]interface{} `json:"settings"`
 	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
 }
 
-// ListBoards retrieves all boards.
-func ListBoards(ctx context.Context, db *pgxpool.Pool) ([]Board, error) {
-	rows, err := db.Query(ctx, "SELECT id, name, slug, description, settings, created_at FROM boards")
+// IntSetting returns a numeric board setting, or def if it is unset or not a number.
+func (b *Board) IntSetting(key string, def int) int {
+	if val, ok := b.Settings[key].(float64); ok {
+		return int(val)
+	}
+	return def
+}
+
+// BoolSetting returns a boolean board setting, or def if it is unset or not a boolean.
+func (b *Board) BoolSetting(key string, def bool) bool {
+	if val, ok := b.Settings[key].(bool); ok {
+		return val
+	}
+	return def
+}
+
+// StringSetting returns a string board setting, or def if it is unset or not a string.
+func (b *Board) StringSetting(key string, def string) string {
+	if val, ok := b.Settings[key].(string); ok {
+		return val
+	}
+	return def
+}
+
+// ListBoards retrieves up to limit boards after the cursor, ordered by ID, and the
+// cursor for the next page if there is one.
+func ListBoards(ctx context.Context, db *pgxpool.Pool, after *Cursor, limit int) ([]Board, *Cursor, error) {
+	rows, err := db.Query(ctx,
+		"SELECT id, name, slug, description, settings, created_at, updated_at FROM boards WHERE id > $1 ORDER BY id ASC LIMIT $2",
+		cursorID(after), limit+1,
+	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	var boards []Board
 	for rows.Next() {
 		var b Board
-		if err := rows.Scan(&b.ID, &b.Name, &b.Slug, &b.Description, &b.Settings, &b.CreatedAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&b.ID, &b.Name, &b.Slug, &b.Description, &b.Settings, &b.CreatedAt, &b.UpdatedAt); err != nil {
+			return nil, nil, err
 		}
 		boards = append(boards, b)
 	}
-	return boards, nil
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(boards) > limit {
+		boards = boards[:limit]
+		return boards, &Cursor{ID: boards[limit-1].ID}, nil
+	}
+	return boards, nil, nil
+}
+
+// BoardsVersion returns the number of boards and when any of them last changed,
+// for use as cache validators.
+func BoardsVersion(ctx context.Context, db *pgxpool.Pool) (int, time.Time, error) {
+	var count int
+	var lastModified time.Time
+	err := db.QueryRow(ctx, "SELECT COUNT(*), COALESCE(MAX(updated_at), to_timestamp(0)) FROM boards").Scan(&count, &lastModified)
+	return count, lastModified, err
 }
 
 // CreateBoard creates a new board.
 func CreateBoard(ctx context.Context, db *pgxpool.Pool, board *Board) error {
 	return db.QueryRow(ctx,
-		"INSERT INTO boards (name, slug, description, settings) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		"INSERT INTO boards (name, slug, description, settings) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at",
 		board.Name, board.Slug, board.Description, board.Settings,
-	).Scan(&board.ID, &board.CreatedAt)
+	).Scan(&board.ID, &board.CreatedAt, &board.UpdatedAt)
+}
+
+// GetBoardBySlug retrieves a board by its slug.
+func GetBoardBySlug(ctx context.Context, db *pgxpool.Pool, slug string) (*Board, error) {
+	var b Board
+	err := db.QueryRow(ctx,
+		"SELECT id, name, slug, description, settings, created_at, updated_at FROM boards WHERE slug = $1", slug,
+	).Scan(&b.ID, &b.Name, &b.Slug, &b.Description, &b.Settings, &b.CreatedAt, &b.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("board not found")
+	}
+	return &b, err
+}
+
+// GetBoard retrieves a board by ID.
+func GetBoard(ctx context.Context, db *pgxpool.Pool, boardID int) (*Board, error) {
+	var b Board
+	err := db.QueryRow(ctx,
+		"SELECT id, name, slug, description, settings, created_at, updated_at FROM boards WHERE id = $1", boardID,
+	).Scan(&b.ID, &b.Name, &b.Slug, &b.Description, &b.Settings, &b.CreatedAt, &b.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("board not found")
+	}
+	return &b, err
 }
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Cursor is a keyset pagination position: the sort key of the last row on a page.
+// Lists ordered by ID alone leave Time zero.
+type Cursor struct {
+	Time time.Time `json:"t"`
+	ID   int       `json:"id"`
+}
+
+// cursorTime returns the cursor's timestamp as a query argument, or nil for the first page.
+func cursorTime(after *Cursor) *time.Time {
+	if after == nil {
+		return nil
+	}
+	return &after.Time
+}
+
+// cursorID returns the cursor's ID as a query argument, or 0 for the first page.
+func cursorID(after *Cursor) int {
+	if after == nil {
+		return 0
+	}
+	return after.ID
+}
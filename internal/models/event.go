@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EventChannel is the Postgres NOTIFY channel that announces new events.
+const EventChannel = "noppera_events"
+
+// Event types published to live subscribers.
+const (
+	EventPostCreated   = "post.created"
+	EventPostUpdated   = "post.updated"
+	EventPostDeleted   = "post.deleted"
+	EventThreadUpdated = "thread.updated"
+	EventPollUpdated   = "poll.updated"
+)
+
+// Event represents a change on a board or thread delivered to live subscribers.
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	BoardID   int             `json:"board_id"`
+	ThreadID  int             `json:"thread_id"`
+	PostID    *int            `json:"post_id"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// eventLockKey is the transaction-level advisory lock that serializes event inserts.
+const eventLockKey = 0x6e6f7070
+
+// CreateEvent records a new event; a trigger notifies listeners once it commits.
+// Inserts are serialized by an advisory lock held until commit, so events become
+// visible in ID order and subscribers resuming after an ID never skip one that was
+// assigned a lower ID but committed later.
+func CreateEvent(ctx context.Context, db *pgxpool.Pool, event *Event) error {
+	if event.Payload == nil {
+		event.Payload = json.RawMessage("{}")
+	}
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create event: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", eventLockKey); err != nil {
+		return fmt.Errorf("failed to create event: %w", err)
+	}
+	err = tx.QueryRow(ctx,
+		"INSERT INTO events (type, board_id, thread_id, post_id, payload) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		event.Type, event.BoardID, event.ThreadID, event.PostID, event.Payload,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create event: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to create event: %w", err)
+	}
+	return nil
+}
+
+// GetEvent retrieves an event by ID.
+func GetEvent(ctx context.Context, db *pgxpool.Pool, eventID int64) (*Event, error) {
+	var e Event
+	err := db.QueryRow(ctx,
+		"SELECT id, type, board_id, thread_id, post_id, payload, created_at FROM events WHERE id = $1", eventID,
+	).Scan(&e.ID, &e.Type, &e.BoardID, &e.ThreadID, &e.PostID, &e.Payload, &e.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("event not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+	return &e, nil
+}
+
+// ListEvents retrieves up to limit events after afterID that belong to any of the
+// given boards or threads, oldest first.
+func ListEvents(ctx context.Context, db *pgxpool.Pool, afterID int64, boardIDs, threadIDs []int, limit int) ([]Event, error) {
+	rows, err := db.Query(ctx,
+		"SELECT id, type, board_id, thread_id, post_id, payload, created_at FROM events "+
+			"WHERE id > $1 AND (board_id = ANY($2) OR thread_id = ANY($3)) ORDER BY id ASC LIMIT $4",
+		afterID, boardIDs, threadIDs, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.Type, &e.BoardID, &e.ThreadID, &e.PostID, &e.Payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ListEventsSince retrieves up to limit events of any board after afterID, oldest first.
+func ListEventsSince(ctx context.Context, db *pgxpool.Pool, afterID int64, limit int) ([]Event, error) {
+	rows, err := db.Query(ctx,
+		"SELECT id, type, board_id, thread_id, post_id, payload, created_at FROM events WHERE id > $1 ORDER BY id ASC LIMIT $2",
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.Type, &e.BoardID, &e.ThreadID, &e.PostID, &e.Payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// LatestEventID returns the highest event ID recorded so far, or 0 if there are none.
+func LatestEventID(ctx context.Context, db *pgxpool.Pool) (int64, error) {
+	var id int64
+	if err := db.QueryRow(ctx, "SELECT COALESCE(MAX(id), 0) FROM events").Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get latest event: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteEventsBefore removes events older than the given time.
+func DeleteEventsBefore(ctx context.Context, db *pgxpool.Pool, before time.Time) error {
+	if _, err := db.Exec(ctx, "DELETE FROM events WHERE created_at < $1", before); err != nil {
+		return fmt.Errorf("failed to delete events: %w", err)
+	}
+	return nil
+}
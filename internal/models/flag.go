@@ -29,11 +29,65 @@ func CreateFlag(ctx context.Context, db *pgxpool.Pool, flag *Flag) error {
 	return nil
 }
 
-// ListFlags retrieves all flags for admin review.
-func ListFlags(ctx context.Context, db *pgxpool.Pool) ([]Flag, error) {
-	rows, err := db.Query(ctx, "SELECT id, post_id, user_id, reason, created_at FROM flags ORDER BY created_at DESC")
+// FlagCounts counts the flags on each of the given posts. Posts without flags are
+// left out of the map.
+func FlagCounts(ctx context.Context, db *pgxpool.Pool, postIDs []int) (map[int]int, error) {
+	return queryFlagCounts(ctx, db,
+		"SELECT post_id, COUNT(*) FROM flags WHERE post_id = ANY($1) GROUP BY post_id", postIDs)
+}
+
+// ThreadFlagCounts counts the flags on a thread's opening post and each of its replies.
+func ThreadFlagCounts(ctx context.Context, db *pgxpool.Pool, threadID int) (map[int]int, error) {
+	return queryFlagCounts(ctx, db,
+		"SELECT f.post_id, COUNT(*) FROM flags f JOIN posts p ON p.id = f.post_id "+
+			"WHERE p.id = $1 OR p.thread_id = $1 GROUP BY f.post_id", threadID)
+}
+
+// ThreadFlagVersion returns the number of flags on a thread's opening post and replies
+// and when the latest was made. Flags change no post, so moderator views, which show
+// flag counts, use it to tell when their cached copies are stale.
+func ThreadFlagVersion(ctx context.Context, db *pgxpool.Pool, threadID int) (int, time.Time, error) {
+	var count int
+	var latest time.Time
+	err := db.QueryRow(ctx,
+		"SELECT COUNT(*), COALESCE(MAX(f.created_at), to_timestamp(0)) FROM flags f JOIN posts p ON p.id = f.post_id "+
+			"WHERE p.id = $1 OR p.thread_id = $1", threadID,
+	).Scan(&count, &latest)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get flag version: %w", err)
+	}
+	return count, latest, nil
+}
+
+// queryFlagCounts reads (post_id, count) rows into a map.
+func queryFlagCounts(ctx context.Context, db *pgxpool.Pool, query string, args ...interface{}) (map[int]int, error) {
+	rows, err := db.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list flags: %w", err)
+		return nil, fmt.Errorf("failed to count flags: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var postID, count int
+		if err := rows.Scan(&postID, &count); err != nil {
+			return nil, err
+		}
+		counts[postID] = count
+	}
+	return counts, rows.Err()
+}
+
+// ListFlags retrieves up to limit flags after the cursor for admin review, newest
+// first, and the cursor for the next page if there is one.
+func ListFlags(ctx context.Context, db *pgxpool.Pool, after *Cursor, limit int) ([]Flag, *Cursor, error) {
+	rows, err := db.Query(ctx,
+		"SELECT id, post_id, user_id, reason, created_at FROM flags "+
+			"WHERE $1::timestamptz IS NULL OR (created_at, id) < ($1, $2) ORDER BY created_at DESC, id DESC LIMIT $3",
+		cursorTime(after), cursorID(after), limit+1,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list flags: %w", err)
 	}
 	defer rows.Close()
 
@@ -41,9 +95,18 @@ func ListFlags(ctx context.Context, db *pgxpool.Pool) ([]Flag, error) {
 	for rows.Next() {
 		var f Flag
 		if err := rows.Scan(&f.ID, &f.PostID, &f.UserID, &f.Reason, &f.CreatedAt); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		flags = append(flags, f)
 	}
-	return flags, nil
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list flags: %w", err)
+	}
+
+	if len(flags) > limit {
+		flags = flags[:limit]
+		last := flags[limit-1]
+		return flags, &Cursor{Time: last.CreatedAt, ID: last.ID}, nil
+	}
+	return flags, nil, nil
 }
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Poll is a poll attached to a thread, with its current tallies.
+type Poll struct {
+	ID        int          `json:"id"`
+	ThreadID  int          `json:"thread_id"`
+	Question  string       `json:"question"`
+	Options   []PollOption `json:"options"`
+	Multiple  bool         `json:"multiple"`
+	ClosesAt  *time.Time   `json:"closes_at"`
+	Closed    bool         `json:"closed"`
+	Voters    int          `json:"voters"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// PollOption is one answer of a poll and the number of votes it has received.
+type PollOption struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// CreatePoll stores a poll for the thread in poll.ThreadID.
+func CreatePoll(ctx context.Context, db DBTX, poll *Poll) error {
+	options := make([]string, len(poll.Options))
+	for i, o := range poll.Options {
+		options[i] = o.Text
+	}
+	err := db.QueryRow(ctx,
+		"INSERT INTO polls (thread_id, question, options, multiple, closes_at) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		poll.ThreadID, poll.Question, options, poll.Multiple, poll.ClosesAt,
+	).Scan(&poll.ID, &poll.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create poll: %w", err)
+	}
+	return nil
+}
+
+// GetPollByThread retrieves a thread's poll with its tallies, or nil if the thread has
+// no poll. Polls are closed once their close time passes or their thread is archived,
+// which freezes the results.
+func GetPollByThread(ctx context.Context, db *pgxpool.Pool, threadID int) (*Poll, error) {
+	var poll Poll
+	var options []string
+	err := db.QueryRow(ctx,
+		"SELECT p.id, p.thread_id, p.question, p.options, p.multiple, p.closes_at, p.created_at, "+
+			"t.archived_at IS NOT NULL OR COALESCE(p.closes_at <= now(), false) "+
+			"FROM polls p JOIN posts t ON t.id = p.thread_id WHERE p.thread_id = $1",
+		threadID,
+	).Scan(&poll.ID, &poll.ThreadID, &poll.Question, &options, &poll.Multiple, &poll.ClosesAt, &poll.CreatedAt, &poll.Closed)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get poll: %w", err)
+	}
+	poll.Options = make([]PollOption, len(options))
+	for i, text := range options {
+		poll.Options[i].Text = text
+	}
+
+	rows, err := db.Query(ctx,
+		"SELECT choice, COUNT(*) FROM poll_votes, unnest(choices) AS choice WHERE poll_id = $1 GROUP BY choice",
+		poll.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count votes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var choice, votes int
+		if err := rows.Scan(&choice, &votes); err != nil {
+			return nil, err
+		}
+		if choice >= 0 && choice < len(poll.Options) {
+			poll.Options[choice].Votes = votes
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count votes: %w", err)
+	}
+
+	err = db.QueryRow(ctx, "SELECT COUNT(*) FROM poll_votes WHERE poll_id = $1", poll.ID).Scan(&poll.Voters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count voters: %w", err)
+	}
+	return &poll, nil
+}
+
+// Vote records a voter's ballot, the indexes of the options they chose, along with the
+// hash of the IP it came from. Each voter and each IP hash may vote once per poll, so an
+// account and the IP it votes from are both used up by one ballot. Votes are refused once the poll has closed or its thread has
+// been archived, deleted or has expired; the thread row is share-locked so a vote cannot slip in
+// while the thread is being archived.
+func Vote(ctx context.Context, db *pgxpool.Pool, pollID int, voter, ipHash string, choices []int) error {
+	tag, err := db.Exec(ctx,
+		"INSERT INTO poll_votes (poll_id, voter, ip_hash, choices) "+
+			"SELECT p.id, $2, $4, $3 FROM polls p JOIN posts t ON t.id = p.thread_id "+
+			"WHERE p.id = $1 AND t.archived_at IS NULL AND t.deleted_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > now()) "+
+			"AND (p.closes_at IS NULL OR p.closes_at > now()) "+
+			"FOR SHARE OF t "+
+			"ON CONFLICT DO NOTHING",
+		pollID, voter, choices, ipHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to vote: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	var voted bool
+	err = db.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM poll_votes WHERE poll_id = $1 AND (voter = $2 OR ip_hash = $3))", pollID, voter, ipHash,
+	).Scan(&voted)
+	if err != nil {
+		return fmt.Errorf("failed to vote: %w", err)
+	}
+	if voted {
+		return fmt.Errorf("already voted")
+	}
+	return fmt.Errorf("poll closed")
+}
@@ -11,75 +11,253 @@ import (
 
 // Post represents a thread or reply.
 type Post struct {
-	ID           int                    `json:"id"`
-	BoardID      int                    `json:"board_id"`
-	ThreadID     *int                   `json:"thread_id"`
-	UserID       *int                   `json:"user_id"`
-	Title        *string                `json:"title"`
-	Content      string                 `json:"content"`
-	ImageURL     *string                `json:"image_url"`
-	Metadata     map[string]interface{} `json:"metadata"`
-	CreatedAt    time.Time              `json:"created_at"`
-	UpdatedAt    *time.Time             `json:"updated_at"`
-	LastBumpedAt time.Time              `json:"last_bumped_at"`
-	ArchivedAt   *time.Time             `json:"archived_at"`
-}
-
-// ListThreads retrieves all active threads for a board.
-func ListThreads(ctx context.Context, db *pgxpool.Pool, boardID string) ([]Post, error) {
-	rows, err := db.Query(ctx,
-		"SELECT id, board_id, user_id, title, content, image_url, metadata, created_at, updated_at, last_bumped_at, archived_at "+
-			"FROM posts WHERE board_id = $1 AND thread_id IS NULL AND archived_at IS NULL ORDER BY last_bumped_at DESC",
-		boardID,
+	ID            int                    `json:"id"`
+	BoardID       int                    `json:"board_id"`
+	Number        int                    `json:"number"`
+	ThreadID      *int                   `json:"thread_id"`
+	UserID        *int                   `json:"user_id"`
+	Name          *string                `json:"name"`
+	Tripcode      *string                `json:"tripcode"`
+	Capcode       *string                `json:"capcode,omitempty"`
+	PosterID      *string                `json:"poster_id"`
+	IPHash        *string                `json:"-"`
+	Title         *string                `json:"title"`
+	Content       string                 `json:"content"`
+	ContentHTML   string                 `json:"content_html"`
+	ImageURL      *string                `json:"image_url"`
+	Spoiler       bool                   `json:"spoiler"`
+	Metadata      map[string]interface{} `json:"metadata"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     *time.Time             `json:"updated_at"`
+	EditedAt      *time.Time             `json:"edited_at"`
+	Edited        bool                   `json:"edited"`
+	LastBumpedAt  time.Time              `json:"last_bumped_at"`
+	ArchivedAt    *time.Time             `json:"archived_at"`
+	ExpiresAt     *time.Time             `json:"expires_at,omitempty"`
+	Sage          bool                   `json:"sage"`
+	Sticky        *int                   `json:"sticky,omitempty"`
+	Locked        bool                   `json:"locked,omitempty"`
+	Cyclical      bool                   `json:"cyclical,omitempty"`
+	Deleted       bool                   `json:"deleted"`
+	DeletedAt     *time.Time             `json:"deleted_at,omitempty"`
+	DeletedBy     *int                   `json:"deleted_by,omitempty"`
+	DeleteReason  *string                `json:"delete_reason,omitempty"`
+	FileDeletedAt *time.Time             `json:"file_deleted_at,omitempty"`
+	Status        *ThreadStatus          `json:"status,omitempty"`
+	Poll          *Poll                  `json:"poll,omitempty"`
+	// DeletePassword is the bcrypt hash of the poster's delete password, or the
+	// "sha256:"-prefixed hash of a generated token. CreatePost stores it but it is
+	// never read back with the post.
+	DeletePassword *string `json:"-"`
+	// DeleteToken is a generated delete password, returned only when the post is created.
+	DeleteToken string     `json:"delete_token,omitempty"`
+	Quotes      []QuoteRef `json:"quotes,omitempty"`
+	Backlinks   []QuoteRef `json:"backlinks,omitempty"`
+}
+
+// PostColumns is the posts column list read by ScanPost.
+const PostColumns = "id, board_id, number, thread_id, user_id, name, tripcode, capcode, poster_id, ip_hash, title, content, content_html, image_url, spoiler, metadata, " +
+	"created_at, updated_at, edited_at, last_bumped_at, archived_at, expires_at, sage, sticky, locked, cyclical, " +
+	"deleted_at, deleted_by, delete_reason, file_deleted_at"
+
+// ScanPost scans a row selected with PostColumns and derives the edited and deleted
+// indicators.
+func ScanPost(row pgx.Row, p *Post) error {
+	err := row.Scan(&p.ID, &p.BoardID, &p.Number, &p.ThreadID, &p.UserID, &p.Name, &p.Tripcode, &p.Capcode, &p.PosterID, &p.IPHash, &p.Title, &p.Content, &p.ContentHTML, &p.ImageURL, &p.Spoiler, &p.Metadata,
+		&p.CreatedAt, &p.UpdatedAt, &p.EditedAt, &p.LastBumpedAt, &p.ArchivedAt, &p.ExpiresAt, &p.Sage, &p.Sticky, &p.Locked, &p.Cyclical,
+		&p.DeletedAt, &p.DeletedBy, &p.DeleteReason, &p.FileDeletedAt)
+	p.Edited = p.EditedAt != nil
+	p.Deleted = p.DeletedAt != nil
+	return err
+}
+
+// ListThreads retrieves up to limit active, unexpired threads for a board after the cursor, most
+// recently bumped first, and the cursor for the next page if there is one. The first
+// page is headed by the board's sticky threads in sticky order, which do not count
+// towards limit and are left out of later pages.
+func ListThreads(ctx context.Context, db *pgxpool.Pool, boardID int, after *Cursor, limit int) ([]Post, *Cursor, error) {
+	var threads []Post
+	if after == nil {
+		stickies, err := queryPosts(ctx, db,
+			"SELECT "+PostColumns+" FROM posts WHERE board_id = $1 AND thread_id IS NULL AND archived_at IS NULL "+
+				"AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > now()) AND sticky IS NOT NULL ORDER BY sticky ASC, id DESC",
+			boardID,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		threads = stickies
+	}
+
+	page, err := queryPosts(ctx, db,
+		"SELECT "+PostColumns+" FROM posts WHERE board_id = $1 AND thread_id IS NULL AND archived_at IS NULL AND deleted_at IS NULL "+
+			"AND (expires_at IS NULL OR expires_at > now()) AND sticky IS NULL "+
+			"AND ($2::timestamptz IS NULL OR (last_bumped_at, id) < ($2, $3)) ORDER BY last_bumped_at DESC, id DESC LIMIT $4",
+		boardID, cursorTime(after), cursorID(after), limit+1,
 	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(page) > limit {
+		page = page[:limit]
+		last := page[limit-1]
+		return append(threads, page...), &Cursor{Time: last.LastBumpedAt, ID: last.ID}, nil
+	}
+	return append(threads, page...), nil, nil
+}
+
+// queryPosts runs a query selecting PostColumns and scans every row.
+func queryPosts(ctx context.Context, db DBTX, query string, args ...interface{}) ([]Post, error) {
+	rows, err := db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var threads []Post
+	var posts []Post
 	for rows.Next() {
 		var p Post
-		if err := rows.Scan(&p.ID, &p.BoardID, &p.UserID, &p.Title, &p.Content, &p.ImageURL, &p.Metadata,
-			&p.CreatedAt, &p.UpdatedAt, &p.LastBumpedAt, &p.ArchivedAt); err != nil {
+		if err := ScanPost(rows, &p); err != nil {
 			return nil, err
 		}
-		threads = append(threads, p)
+		posts = append(posts, p)
 	}
-	return threads, nil
+	return posts, rows.Err()
 }
 
-// CreatePost creates a new post (thread or reply).
-func CreatePost(ctx context.Context, db *pgxpool.Pool, post *Post) error {
+// CreatePost creates a new post (thread or reply), numbering it from its board's post
+// counter. The counter update locks the board row until the caller's transaction
+// ends, so numbers are allocated in order without duplicates.
+func CreatePost(ctx context.Context, db DBTX, post *Post) error {
 	return db.QueryRow(ctx,
-		"INSERT INTO posts (board_id, thread_id, user_id, title, content, image_url, metadata, created_at, last_bumped_at) "+
-			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, last_bumped_at",
-		post.BoardID, post.ThreadID, post.UserID, post.Title, post.Content, post.ImageURL, post.Metadata, post.CreatedAt, post.LastBumpedAt,
-	).Scan(&post.ID, &post.CreatedAt, &post.LastBumpedAt)
+		"WITH counter AS (UPDATE boards SET post_count = post_count + 1 WHERE id = $1 RETURNING post_count) "+
+			"INSERT INTO posts (board_id, number, thread_id, user_id, name, tripcode, capcode, poster_id, ip_hash, title, content, content_html, image_url, spoiler, metadata, "+
+			"created_at, last_bumped_at, expires_at, sage, delete_password) "+
+			"VALUES ($1, (SELECT post_count FROM counter), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) "+
+			"RETURNING id, number, created_at, last_bumped_at",
+		post.BoardID, post.ThreadID, post.UserID, post.Name, post.Tripcode, post.Capcode, post.PosterID, post.IPHash, post.Title, post.Content, post.ContentHTML, post.ImageURL, post.Spoiler, post.Metadata,
+		post.CreatedAt, post.LastBumpedAt, post.ExpiresAt, post.Sage, post.DeletePassword,
+	).Scan(&post.ID, &post.Number, &post.CreatedAt, &post.LastBumpedAt)
+}
+
+// SetPosterID stores a post's poster ID. Thread IDs are derived from the thread's own
+// ID, which is only known once the opening post has been inserted.
+func SetPosterID(ctx context.Context, db DBTX, postID int, posterID string) error {
+	_, err := db.Exec(ctx, "UPDATE posts SET poster_id = $1 WHERE id = $2", posterID, postID)
+	return err
 }
 
 // UpdateThreadBumpTime updates the thread's last_bumped_at.
-func UpdateThreadBumpTime(ctx context.Context, db *pgxpool.Pool, threadID int, bumpTime time.Time) error {
-	_, err := db.Exec(ctx, "UPDATE posts SET last_bumped_at = $1 WHERE id = $2 AND thread_id IS NULL", bumpTime, threadID)
+func UpdateThreadBumpTime(ctx context.Context, db DBTX, threadID int, bumpTime time.Time) error {
+	_, err := db.Exec(ctx, "UPDATE posts SET last_bumped_at = $1 WHERE id = $2 AND thread_id IS NULL AND archived_at IS NULL", bumpTime, threadID)
 	return err
 }
 
+// ThreadVersion returns the number of posts and backlinks in a thread and when any of
+// them last changed, for use as cache validators. Backlinks are counted because replies
+// in other threads change how this thread is rendered.
+func ThreadVersion(ctx context.Context, db *pgxpool.Pool, threadID int) (int, time.Time, error) {
+	var count int
+	var lastModified time.Time
+	err := db.QueryRow(ctx,
+		"SELECT p.count + q.count, GREATEST(p.changed, q.changed) FROM "+
+			"(SELECT COUNT(*) AS count, MAX(GREATEST(created_at, last_bumped_at, COALESCE(updated_at, created_at))) AS changed "+
+			"FROM posts WHERE (id = $1 OR thread_id = $1) AND archived_at IS NULL) p, "+
+			"(SELECT COUNT(*) AS count, MAX(created_at) AS changed FROM post_quotes WHERE quoted_thread_id = $1) q",
+		threadID,
+	).Scan(&count, &lastModified)
+	return count, lastModified, err
+}
+
 // GetPost retrieves a post by ID.
 func GetPost(ctx context.Context, db *pgxpool.Pool, postID int) (*Post, error) {
 	var p Post
-	err := db.QueryRow(ctx,
-		"SELECT id, board_id, thread_id, user_id, title, content, image_url, metadata, created_at, updated_at, last_bumped_at, archived_at "+
-			"FROM posts WHERE id = $1", postID,
-	).Scan(&p.ID, &p.BoardID, &p.ThreadID, &p.UserID, &p.Title, &p.Content, &p.ImageURL, &p.Metadata,
-		&p.CreatedAt, &p.UpdatedAt, &p.LastBumpedAt, &p.ArchivedAt)
+	err := ScanPost(db.QueryRow(ctx, "SELECT "+PostColumns+" FROM posts WHERE id = $1", postID), &p)
 	if err == pgx.ErrNoRows {
 		return nil, fmt.Errorf("post not found")
 	}
 	return &p, err
 }
 
-// DeletePost deletes a post by ID.
-func DeletePost(ctx context.Context, db *pgxpool.Pool, postID int) error {
-	_, err := db.Exec(ctx, "DELETE FROM posts WHERE id = $1", postID)
-	return err
+// GetPostByNumber retrieves a post by its board post number.
+func GetPostByNumber(ctx context.Context, db *pgxpool.Pool, boardID, number int) (*Post, error) {
+	var p Post
+	err := ScanPost(db.QueryRow(ctx, "SELECT "+PostColumns+" FROM posts WHERE board_id = $1 AND number = $2", boardID, number), &p)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("post not found")
+	}
+	return &p, err
+}
+
+// SoftDeletePost marks a post deleted by deletedBy, keeping the row so replies and
+// quotes to it still resolve, and returns the deleted post.
+func SoftDeletePost(ctx context.Context, db *pgxpool.Pool, postID int, deletedBy *int, reason *string) (*Post, error) {
+	var p Post
+	now := time.Now()
+	err := ScanPost(db.QueryRow(ctx,
+		"UPDATE posts SET deleted_at = $1, deleted_by = $2, delete_reason = $3, updated_at = $1 "+
+			"WHERE id = $4 AND deleted_at IS NULL RETURNING "+PostColumns,
+		now, deletedBy, reason, postID,
+	), &p)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("post not found")
+	}
+	return &p, err
+}
+
+// DeletePostFile detaches a post's image while keeping its text, and returns the post.
+// The caller removes the file from storage.
+func DeletePostFile(ctx context.Context, db DBTX, postID int) (*Post, error) {
+	var p Post
+	now := time.Now()
+	err := ScanPost(db.QueryRow(ctx,
+		"UPDATE posts SET image_url = NULL, spoiler = false, file_deleted_at = $1, updated_at = $1 "+
+			"WHERE id = $2 AND image_url IS NOT NULL RETURNING "+PostColumns,
+		now, postID,
+	), &p)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("post not found")
+	}
+	return &p, err
+}
+
+// ListExpiredThreads retrieves the threads whose expiry time has passed, soonest first.
+func ListExpiredThreads(ctx context.Context, db *pgxpool.Pool, now time.Time) ([]Post, error) {
+	return queryPosts(ctx, db,
+		"SELECT "+PostColumns+" FROM posts WHERE thread_id IS NULL AND expires_at <= $1 ORDER BY expires_at",
+		now,
+	)
+}
+
+// Expired reports whether a thread's expiry time has passed. Expired threads are
+// hidden until the expiry job purges them.
+func (p *Post) Expired() bool {
+	return p.ExpiresAt != nil && !p.ExpiresAt.After(time.Now())
+}
+
+// GetDeletePassword retrieves the hashed delete password of a post, or nil if the post
+// was created without one.
+func GetDeletePassword(ctx context.Context, db *pgxpool.Pool, postID int) (*string, error) {
+	var hash *string
+	err := db.QueryRow(ctx, "SELECT delete_password FROM posts WHERE id = $1", postID).Scan(&hash)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("post not found")
+	}
+	return hash, err
+}
+
+// ListPurgeable retrieves posts soft-deleted before the given time.
+func ListPurgeable(ctx context.Context, db *pgxpool.Pool, before time.Time) ([]Post, error) {
+	return queryPosts(ctx, db, "SELECT "+PostColumns+" FROM posts WHERE deleted_at < $1 ORDER BY id ASC", before)
+}
+
+// Tombstone strips a deleted post down to its place in the thread, hiding what it said
+// and who said it.
+func (p *Post) Tombstone() {
+	p.UserID, p.Name, p.Tripcode, p.Capcode, p.PosterID, p.IPHash, p.Title, p.ImageURL = nil, nil, nil, nil, nil, nil, nil, nil
+	p.Content, p.ContentHTML = "", ""
+	p.Spoiler = false
+	p.Metadata = map[string]interface{}{}
+	p.Quotes = nil
 }
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FileDeletion is a purged post's file queued for removal from storage.
+type FileDeletion struct {
+	ID       int
+	URL      string
+	Attempts int
+}
+
+// PurgePost permanently deletes a post and, if it is a thread, all of its replies.
+// Their flags, quotes and revisions go with them, and their files are queued for
+// deletion from storage in the same statement, which are returned.
+func PurgePost(ctx context.Context, db *pgxpool.Pool, postID int) ([]FileDeletion, error) {
+	rows, err := db.Query(ctx,
+		"WITH purged AS (DELETE FROM posts WHERE id = $1 OR thread_id = $1 RETURNING image_url) "+
+			"INSERT INTO file_deletions (url) SELECT image_url FROM purged WHERE image_url IS NOT NULL RETURNING id, url, attempts",
+		postID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge post: %w", err)
+	}
+	return scanFileDeletions(rows)
+}
+
+// QueueFileDeletions queues files of posts deleted by other means for removal from
+// storage, so they are retried like purged files if deleting them fails.
+func QueueFileDeletions(ctx context.Context, db DBTX, urls []string) ([]FileDeletion, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	rows, err := db.Query(ctx, "INSERT INTO file_deletions (url) SELECT unnest($1::text[]) RETURNING id, url, attempts", urls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue file deletions: %w", err)
+	}
+	return scanFileDeletions(rows)
+}
+
+// ListFileDeletions retrieves up to limit queued file deletions, oldest first.
+func ListFileDeletions(ctx context.Context, db *pgxpool.Pool, limit int) ([]FileDeletion, error) {
+	rows, err := db.Query(ctx, "SELECT id, url, attempts FROM file_deletions ORDER BY id ASC LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file deletions: %w", err)
+	}
+	return scanFileDeletions(rows)
+}
+
+// CompleteFileDeletion removes a file deletion from the queue once the file is gone.
+func CompleteFileDeletion(ctx context.Context, db *pgxpool.Pool, id int) error {
+	_, err := db.Exec(ctx, "DELETE FROM file_deletions WHERE id = $1", id)
+	return err
+}
+
+// FailFileDeletion records a failed attempt, leaving the deletion queued for retry.
+func FailFileDeletion(ctx context.Context, db *pgxpool.Pool, id int, cause error) error {
+	_, err := db.Exec(ctx,
+		"UPDATE file_deletions SET attempts = attempts + 1, last_error = $1 WHERE id = $2", cause.Error(), id,
+	)
+	return err
+}
+
+// scanFileDeletions scans and closes rows of id, url and attempts.
+func scanFileDeletions(rows pgx.Rows) ([]FileDeletion, error) {
+	defer rows.Close()
+	var deletions []FileDeletion
+	for rows.Next() {
+		var d FileDeletion
+		if err := rows.Scan(&d.ID, &d.URL, &d.Attempts); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
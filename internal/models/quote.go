@@ -0,0 +1,158 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cobalto/noppera/internal/markup"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// QuoteRef identifies a post linked by a quote, either one a post quotes or one
+// replying to it (a backlink). Number and ThreadNumber are the board post numbers
+// used in links; PostID and ThreadID are the global IDs.
+type QuoteRef struct {
+	PostID       int    `json:"post_id"`
+	Number       int    `json:"number"`
+	ThreadID     int    `json:"thread_id"`
+	ThreadNumber int    `json:"thread_number"`
+	Board        string `json:"board"`
+	CrossThread  bool   `json:"cross_thread"`
+	boardID      int
+}
+
+// ResolveQuotes resolves the references found in a new post's content and sets
+// post.Quotes to the valid ones, before the post is stored so they can be rendered.
+// Plain >>123 references are looked up by post number on the post's own board and
+// >>>/board/123 on the named board; references to missing posts are left unresolved.
+func ResolveQuotes(ctx context.Context, db *pgxpool.Pool, post *Post, refs []markup.Reference) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	slugs := make([]string, len(refs))
+	numbers := make([]int, len(refs))
+	for i, ref := range refs {
+		slugs[i], numbers[i] = ref.Board, ref.Number
+	}
+	rows, err := db.Query(ctx,
+		"SELECT r.slug, p.id, p.number, p.board_id, t.id, t.number, b.slug FROM unnest($2::text[], $3::int[]) AS r(slug, number) "+
+			"JOIN boards b ON (r.slug = '' AND b.id = $1) OR b.slug = r.slug "+
+			"JOIN posts p ON p.board_id = b.id AND p.number = r.number "+
+			"JOIN posts t ON t.id = COALESCE(p.thread_id, p.id)",
+		post.BoardID, slugs, numbers,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to resolve quotes: %w", err)
+	}
+	defer rows.Close()
+
+	targets := make(map[markup.Reference]QuoteRef)
+	for rows.Next() {
+		var ref markup.Reference
+		var q QuoteRef
+		if err := rows.Scan(&ref.Board, &q.PostID, &q.Number, &q.boardID, &q.ThreadID, &q.ThreadNumber, &q.Board); err != nil {
+			return fmt.Errorf("failed to resolve quotes: %w", err)
+		}
+		ref.Number = q.Number
+		targets[ref] = q
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to resolve quotes: %w", err)
+	}
+
+	// A new post's ID is still 0, so none of a new thread's quotes are in-thread
+	threadID := post.ID
+	if post.ThreadID != nil {
+		threadID = *post.ThreadID
+	}
+	resolved := make(map[int]bool)
+	for _, ref := range refs {
+		q, ok := targets[ref]
+		if !ok || resolved[q.PostID] || q.PostID == post.ID {
+			continue
+		}
+		resolved[q.PostID] = true
+		q.CrossThread = q.ThreadID != threadID
+		post.Quotes = append(post.Quotes, q)
+	}
+	return nil
+}
+
+// QuoteTarget returns the resolved quote that a reference in the post's content
+// points to, if ResolveQuotes resolved it.
+func (p *Post) QuoteTarget(ref markup.Reference) (*QuoteRef, bool) {
+	for i, q := range p.Quotes {
+		if q.Number != ref.Number {
+			continue
+		}
+		if (ref.Board == "" && q.boardID == p.BoardID) || (ref.Board != "" && ref.Board == q.Board) {
+			return &p.Quotes[i], true
+		}
+	}
+	return nil, false
+}
+
+// SaveQuotes records the resolved quotes of a newly stored post.
+func SaveQuotes(ctx context.Context, db DBTX, post *Post) error {
+	threadID := post.ID
+	if post.ThreadID != nil {
+		threadID = *post.ThreadID
+	}
+	for _, q := range post.Quotes {
+		_, err := db.Exec(ctx,
+			"INSERT INTO post_quotes (post_id, board_id, thread_id, quoted_post_id, quoted_board_id, quoted_thread_id) "+
+				"VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING",
+			post.ID, post.BoardID, threadID, q.PostID, q.boardID, q.ThreadID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save quote: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReplaceQuotes replaces the recorded quotes of an edited post with its newly
+// resolved ones.
+func ReplaceQuotes(ctx context.Context, db DBTX, post *Post) error {
+	if _, err := db.Exec(ctx, "DELETE FROM post_quotes WHERE post_id = $1", post.ID); err != nil {
+		return fmt.Errorf("failed to clear quotes: %w", err)
+	}
+	return SaveQuotes(ctx, db, post)
+}
+
+// ThreadQuotes loads the quotes made by posts in a thread and the backlinks to them,
+// keyed by post ID. Backlinks include replies from other threads.
+func ThreadQuotes(ctx context.Context, db *pgxpool.Pool, threadID int) (map[int][]QuoteRef, map[int][]QuoteRef, error) {
+	rows, err := db.Query(ctx,
+		"SELECT q.post_id, fp.number, q.thread_id, ft.number, pb.slug, q.quoted_post_id, tp.number, q.quoted_thread_id, tt.number, qb.slug "+
+			"FROM post_quotes q JOIN boards pb ON pb.id = q.board_id JOIN boards qb ON qb.id = q.quoted_board_id "+
+			"JOIN posts fp ON fp.id = q.post_id JOIN posts ft ON ft.id = q.thread_id "+
+			"JOIN posts tp ON tp.id = q.quoted_post_id JOIN posts tt ON tt.id = q.quoted_thread_id "+
+			"WHERE q.thread_id = $1 OR q.quoted_thread_id = $1 ORDER BY q.post_id ASC, q.quoted_post_id ASC",
+		threadID,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load quotes: %w", err)
+	}
+	defer rows.Close()
+
+	quotes := make(map[int][]QuoteRef)
+	backlinks := make(map[int][]QuoteRef)
+	for rows.Next() {
+		var from, to QuoteRef
+		if err := rows.Scan(&from.PostID, &from.Number, &from.ThreadID, &from.ThreadNumber, &from.Board,
+			&to.PostID, &to.Number, &to.ThreadID, &to.ThreadNumber, &to.Board); err != nil {
+			return nil, nil, fmt.Errorf("failed to load quotes: %w", err)
+		}
+		from.CrossThread = from.ThreadID != to.ThreadID
+		to.CrossThread = from.CrossThread
+		if from.ThreadID == threadID {
+			quotes[from.PostID] = append(quotes[from.PostID], to)
+		}
+		if to.ThreadID == threadID {
+			backlinks[to.PostID] = append(backlinks[to.PostID], from)
+		}
+	}
+	return quotes, backlinks, rows.Err()
+}
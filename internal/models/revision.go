@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Revision is a previous version of a post's title and content, kept when the post
+// is edited.
+type Revision struct {
+	ID          int       `json:"id"`
+	PostID      int       `json:"post_id"`
+	Revision    int       `json:"revision"`
+	Title       *string   `json:"title"`
+	Content     string    `json:"content"`
+	ContentHTML string    `json:"content_html"`
+	EditedBy    *int      `json:"edited_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// LockPost locks a post's row until the end of the transaction and returns the post.
+func LockPost(ctx context.Context, tx pgx.Tx, postID int) (*Post, error) {
+	var p Post
+	err := ScanPost(tx.QueryRow(ctx, "SELECT "+PostColumns+" FROM posts WHERE id = $1 FOR UPDATE", postID), &p)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("post not found")
+	}
+	return &p, err
+}
+
+// EditPost stores old's title and content as a new revision, edited by editorID, and
+// replaces them with post's. post.EditedAt and post.UpdatedAt are set to the edit
+// time. The caller should hold a lock on the post from LockPost.
+func EditPost(ctx context.Context, tx pgx.Tx, old, post *Post, editorID *int) error {
+	_, err := tx.Exec(ctx,
+		"INSERT INTO post_revisions (post_id, revision, title, content, content_html, edited_by) "+
+			"SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5 FROM post_revisions WHERE post_id = $1",
+		old.ID, old.Title, old.Content, old.ContentHTML, editorID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save revision: %w", err)
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(ctx,
+		"UPDATE posts SET title = $1, content = $2, content_html = $3, edited_at = $4, updated_at = $4 WHERE id = $5",
+		post.Title, post.Content, post.ContentHTML, now, post.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update post: %w", err)
+	}
+	post.EditedAt, post.UpdatedAt, post.Edited = &now, &now, true
+	return nil
+}
+
+// ListRevisions retrieves a post's previous versions, oldest first.
+func ListRevisions(ctx context.Context, db *pgxpool.Pool, postID int) ([]Revision, error) {
+	rows, err := db.Query(ctx,
+		"SELECT id, post_id, revision, title, content, content_html, edited_by, created_at "+
+			"FROM post_revisions WHERE post_id = $1 ORDER BY revision ASC",
+		postID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		var r Revision
+		if err := rows.Scan(&r.ID, &r.PostID, &r.Revision, &r.Title, &r.Content, &r.ContentHTML, &r.EditedBy, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
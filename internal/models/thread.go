@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ThreadLimits are the per-thread limits configured for a board.
+type ThreadLimits struct {
+	Replies int
+	Bump    int
+	Images  int
+}
+
+// ThreadStatus reports a thread's reply and image counts against its board's limits.
+type ThreadStatus struct {
+	Replies           int  `json:"replies"`
+	Images            int  `json:"images"`
+	ReplyLimit        int  `json:"reply_limit"`
+	BumpLimit         int  `json:"bump_limit"`
+	ImageLimit        int  `json:"image_limit"`
+	ReplyLimitReached bool `json:"reply_limit_reached"`
+	BumpLimitReached  bool `json:"bump_limit_reached"`
+	ImageLimitReached bool `json:"image_limit_reached"`
+}
+
+// NewThreadStatus compares reply and image counts with a board's limits.
+func NewThreadStatus(replies, images int, limits ThreadLimits) *ThreadStatus {
+	return &ThreadStatus{
+		Replies:           replies,
+		Images:            images,
+		ReplyLimit:        limits.Replies,
+		BumpLimit:         limits.Bump,
+		ImageLimit:        limits.Images,
+		ReplyLimitReached: replies >= limits.Replies,
+		BumpLimitReached:  replies >= limits.Bump,
+		ImageLimitReached: images >= limits.Images,
+	}
+}
+
+// ThreadStatuses counts the active, undeleted replies and images, including the opening post's,
+// of each thread and reports them against limits.
+func ThreadStatuses(ctx context.Context, db DBTX, threadIDs []int, limits ThreadLimits) (map[int]*ThreadStatus, error) {
+	rows, err := db.Query(ctx,
+		"SELECT COALESCE(thread_id, id), COUNT(*) FILTER (WHERE thread_id IS NOT NULL), COUNT(image_url) "+
+			"FROM posts WHERE (id = ANY($1) OR thread_id = ANY($1)) AND archived_at IS NULL AND deleted_at IS NULL "+
+			"GROUP BY COALESCE(thread_id, id)",
+		threadIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := make(map[int]*ThreadStatus, len(threadIDs))
+	for _, id := range threadIDs {
+		statuses[id] = NewThreadStatus(0, 0, limits)
+	}
+	for rows.Next() {
+		var threadID, replies, images int
+		if err := rows.Scan(&threadID, &replies, &images); err != nil {
+			return nil, err
+		}
+		statuses[threadID] = NewThreadStatus(replies, images, limits)
+	}
+	return statuses, rows.Err()
+}
+
+// GetThreadStatus reports a single thread's counts against limits.
+func GetThreadStatus(ctx context.Context, db DBTX, threadID int, limits ThreadLimits) (*ThreadStatus, error) {
+	statuses, err := ThreadStatuses(ctx, db, []int{threadID}, limits)
+	if err != nil {
+		return nil, err
+	}
+	return statuses[threadID], nil
+}
+
+// SetThreadState sets a thread's sticky order (nil to unsticky), locked and cyclical
+// flags, and returns the updated thread.
+func SetThreadState(ctx context.Context, db *pgxpool.Pool, threadID int, sticky *int, locked, cyclical bool) (*Post, error) {
+	var p Post
+	err := ScanPost(db.QueryRow(ctx,
+		"UPDATE posts SET sticky = $1, locked = $2, cyclical = $3, updated_at = $4 "+
+			"WHERE id = $5 AND thread_id IS NULL AND archived_at IS NULL AND deleted_at IS NULL RETURNING "+PostColumns,
+		sticky, locked, cyclical, time.Now(), threadID,
+	), &p)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("thread not found")
+	}
+	return &p, err
+}
+
+// PruneReplies deletes a thread's oldest active, undeleted replies so that at most keep
+// remain, counting replies the same way ThreadStatuses does, and returns the deleted
+// replies so their images can be removed.
+func PruneReplies(ctx context.Context, db DBTX, threadID, keep int) ([]Post, error) {
+	return queryPosts(ctx, db,
+		"DELETE FROM posts WHERE id IN (SELECT id FROM posts WHERE thread_id = $1 AND archived_at IS NULL AND deleted_at IS NULL "+
+			"ORDER BY created_at DESC, id DESC OFFSET $2) RETURNING "+PostColumns,
+		threadID, keep,
+	)
+}
+
+// CountThreads returns the number of active threads on a board.
+func CountThreads(ctx context.Context, db DBTX, boardID int) (int, error) {
+	var count int
+	err := db.QueryRow(ctx,
+		"SELECT COUNT(*) FROM posts WHERE board_id = $1 AND thread_id IS NULL AND archived_at IS NULL AND deleted_at IS NULL", boardID,
+	).Scan(&count)
+	return count, err
+}
+
+// ArchiveOldestThreads archives up to n of a board's lowest-bumped non-sticky threads
+// to make room for new ones, returning the archived threads.
+func ArchiveOldestThreads(ctx context.Context, db DBTX, boardID, n int) ([]Post, error) {
+	return queryPosts(ctx, db,
+		"UPDATE posts SET archived_at = $1 WHERE id IN (SELECT id FROM posts WHERE board_id = $2 AND thread_id IS NULL "+
+			"AND archived_at IS NULL AND deleted_at IS NULL AND sticky IS NULL ORDER BY last_bumped_at ASC, id ASC LIMIT $3) RETURNING "+PostColumns,
+		time.Now(), boardID, n,
+	)
+}
+
+// LockThread locks an active thread's row until the end of the transaction and returns
+// the thread, serializing replies to it.
+func LockThread(ctx context.Context, tx pgx.Tx, threadID int) (*Post, error) {
+	var p Post
+	err := ScanPost(tx.QueryRow(ctx,
+		"SELECT "+PostColumns+" FROM posts WHERE id = $1 AND thread_id IS NULL AND archived_at IS NULL AND deleted_at IS NULL FOR UPDATE",
+		threadID,
+	), &p)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("thread not found")
+	}
+	return &p, err
+}
+
+// LockBoard locks a board's row until the end of the transaction, serializing post
+// creation on it. Callers that also lock a thread must lock the board first, since
+// CreatePost's post counter update will lock the board anyway.
+func LockBoard(ctx context.Context, tx pgx.Tx, boardID int) error {
+	var id int
+	err := tx.QueryRow(ctx, "SELECT id FROM boards WHERE id = $1 FOR NO KEY UPDATE", boardID).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("board not found")
+	}
+	return err
+}
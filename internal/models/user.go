@@ -9,20 +9,45 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// User roles, from least to most privileged. Staff roles may post with a capcode.
+const (
+	RoleUser    = "user"
+	RoleJanitor = "janitor"
+	RoleMod     = "mod"
+	RoleAdmin   = "admin"
+)
+
+// roleRanks orders the roles by privilege.
+var roleRanks = map[string]int{RoleUser: 0, RoleJanitor: 1, RoleMod: 2, RoleAdmin: 3}
+
+// ValidRole reports whether role is one of the user roles.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role is at least as privileged as min. Unknown roles
+// rank below every known one.
+func RoleAtLeast(role, min string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[min]
+}
+
 // User represents a user account.
 type User struct {
 	ID        int       `json:"id"`
 	Username  string    `json:"username"`
-	Password  string    `json:"password"`
+	Password  string    `json:"-"`
 	IsAdmin   bool      `json:"is_admin"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
 // CreateUser creates a new user in the database.
 func CreateUser(ctx context.Context, db *pgxpool.Pool, user *User) error {
 	err := db.QueryRow(ctx,
-		"INSERT INTO users (username, password, is_admin) VALUES ($1, $2, $3) RETURNING id, created_at",
-		user.Username, user.Password, user.IsAdmin,
+		"INSERT INTO users (username, password, is_admin, role) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		user.Username, user.Password, user.IsAdmin, user.Role,
 	).Scan(&user.ID, &user.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
@@ -34,9 +59,9 @@ func CreateUser(ctx context.Context, db *pgxpool.Pool, user *User) error {
 func GetUserByUsername(ctx context.Context, db *pgxpool.Pool, username string) (*User, error) {
 	var u User
 	err := db.QueryRow(ctx,
-		"SELECT id, username, password, is_admin, created_at FROM users WHERE username = $1",
+		"SELECT id, username, password, is_admin, role, created_at FROM users WHERE username = $1",
 		username,
-	).Scan(&u.ID, &u.Username, &u.Password, &u.IsAdmin, &u.CreatedAt)
+	).Scan(&u.ID, &u.Username, &u.Password, &u.IsAdmin, &u.Role, &u.CreatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -45,3 +70,19 @@ func GetUserByUsername(ctx context.Context, db *pgxpool.Pool, username string) (
 	}
 	return &u, nil
 }
+
+// SetUserRole changes a user's role. Only the admin role grants admin access.
+func SetUserRole(ctx context.Context, db *pgxpool.Pool, userID int, role string) (*User, error) {
+	var u User
+	err := db.QueryRow(ctx,
+		"UPDATE users SET role = $1, is_admin = ($1 = 'admin') WHERE id = $2 RETURNING id, username, password, is_admin, role, created_at",
+		role, userID,
+	).Scan(&u.ID, &u.Username, &u.Password, &u.IsAdmin, &u.Role, &u.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set role: %w", err)
+	}
+	return &u, nil
+}
@@ -0,0 +1,59 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cobalto/noppera/internal/models"
+	"github.com/cobalto/noppera/internal/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// retryBatch caps how many queued file deletions RetryFiles attempts per run.
+const retryBatch = 500
+
+// Post permanently removes a post, or a thread with all of its replies, from the
+// database and then deletes their files from storage. The database part runs as a
+// single statement; files that cannot be deleted stay queued for RetryFiles.
+func Post(ctx context.Context, db *pgxpool.Pool, store storage.Storage, postID int) error {
+	deletions, err := models.PurgePost(ctx, db, postID)
+	if err != nil {
+		return fmt.Errorf("failed to purge post %d: %w", postID, err)
+	}
+	deleteFiles(ctx, db, store, deletions)
+	return nil
+}
+
+// Files deletes files already queued for deletion, such as those of replies pruned
+// from cyclical threads. Files that cannot be deleted stay queued for RetryFiles.
+func Files(ctx context.Context, db *pgxpool.Pool, store storage.Storage, deletions []models.FileDeletion) {
+	deleteFiles(ctx, db, store, deletions)
+}
+
+// RetryFiles attempts the file deletions left queued by earlier purges.
+func RetryFiles(ctx context.Context, db *pgxpool.Pool, store storage.Storage) error {
+	deletions, err := models.ListFileDeletions(ctx, db, retryBatch)
+	if err != nil {
+		return err
+	}
+	deleteFiles(ctx, db, store, deletions)
+	return nil
+}
+
+// deleteFiles removes queued files from storage, dequeuing each one that succeeds and
+// recording the failure on the rest.
+func deleteFiles(ctx context.Context, db *pgxpool.Pool, store storage.Storage, deletions []models.FileDeletion) {
+	for _, d := range deletions {
+		if err := store.Delete(ctx, d.URL); err != nil {
+			log.Warn().Err(err).Str("url", d.URL).Int("attempts", d.Attempts+1).Msg("Failed to delete purged file")
+			if err := models.FailFileDeletion(ctx, db, d.ID, err); err != nil {
+				log.Error().Err(err).Int("file_deletion_id", d.ID).Msg("Failed to record file deletion failure")
+			}
+			continue
+		}
+		if err := models.CompleteFileDeletion(ctx, db, d.ID); err != nil {
+			log.Error().Err(err).Int("file_deletion_id", d.ID).Msg("Failed to dequeue file deletion")
+		}
+	}
+}
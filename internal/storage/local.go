@@ -70,7 +70,8 @@ func (s *LocalStorage) Upload(ctx context.Context, data []byte, ext string) (str
 	return url, nil
 }
 
-// Delete removes a file from the local filesystem.
+// Delete removes a file from the local filesystem. A file that is already gone counts
+// as deleted, so deletions can be retried.
 func (s *LocalStorage) Delete(ctx context.Context, url string) error {
 	// Set timeout for file operation
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.StorageTimeout)
@@ -86,7 +87,7 @@ func (s *LocalStorage) Delete(ctx context.Context, url string) error {
 	}()
 	select {
 	case err := <-errChan:
-		if err != nil {
+		if err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to delete file %s: %w", path, err)
 		}
 	case <-ctx.Done():
@@ -0,0 +1,39 @@
+package tripcode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+	"time"
+)
+
+// posterIDLength is the number of characters in a per-thread poster ID.
+const posterIDLength = 8
+
+// IPHash derives a stable hash of a poster's IP address, letting moderators match
+// posts by the same poster across threads without the IP itself being stored.
+func IPHash(ip, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ip))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// PosterID derives a short ID for a poster within one thread from their IP address.
+// The same IP always gets the same ID in a thread and unrelated IDs in other
+// threads. The key rotates every rotation period, chosen by when the thread was
+// created, so IDs stay stable for a thread's lifetime while old keys age out.
+func PosterID(ip string, threadID int, threadCreated time.Time, secret string, rotation time.Duration) string {
+	if rotation <= 0 {
+		rotation = 24 * time.Hour
+	}
+	epoch := make([]byte, 8)
+	binary.BigEndian.PutUint64(epoch, uint64(threadCreated.Unix()/int64(rotation/time.Second)))
+	key := hmac.New(sha256.New, []byte(secret))
+	key.Write(epoch)
+
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	mac.Write([]byte(ip + "|" + strconv.Itoa(threadID)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:posterIDLength]
+}
@@ -0,0 +1,64 @@
+package tripcode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxNameLength caps the display name in runes.
+const MaxNameLength = 75
+
+// tripLength is the number of characters kept from a tripcode hash.
+const tripLength = 10
+
+// Parse splits a "name#password" or "name##password" field into the display name and
+// tripcode. Classic tripcodes (!) hash the password alone, so they are the same on
+// any server; secure tripcodes (!!) are keyed with the server secret and cannot be
+// computed offline. Both may be combined as "name#password##password". The password
+// itself is never returned.
+func Parse(input, secret string) (name, trip string) {
+	name, password, found := strings.Cut(input, "#")
+	name = truncate(strings.TrimSpace(name), MaxNameLength)
+	if !found {
+		return name, ""
+	}
+
+	classic, secure := password, ""
+	if strings.HasPrefix(password, "#") {
+		classic, secure = "", password[1:]
+	} else if i := strings.Index(password, "##"); i >= 0 {
+		classic, secure = password[:i], password[i+2:]
+	}
+
+	if classic != "" {
+		trip += "!" + classicTrip(classic)
+	}
+	if secure != "" {
+		trip += "!!" + secureTrip(secure, secret)
+	}
+	return name, trip
+}
+
+// classicTrip hashes a password without any server secret.
+func classicTrip(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:tripLength]
+}
+
+// secureTrip hashes a password keyed with the server secret.
+func secureTrip(password, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(password))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:tripLength]
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}